@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Tipos de anomalia reportados pelo -anomalies.
+const (
+	anomalyOutlier    = "outlier"     // min ou max a mais de N desvios-padrão da média da própria cidade
+	anomalyFewSamples = "few-samples" // cidade com menos medições que o mínimo configurado
+	anomalyJump       = "jump"        // salto "impossível" entre duas leituras seguidas da mesma cidade
+)
+
+// anomalyConfig guarda os limites usados na detecção.
+// maxJump está em DÉCIMOS, igual aos valores de cityTemperatureInfo.
+type anomalyConfig struct {
+	sigma      float64
+	minSamples int64
+	maxJump    int64
+}
+
+// anomaly é uma linha do relatório de anomalias.
+type anomaly struct {
+	city   string
+	kind   string
+	detail string
+}
+
+// detectAnomalies percorre o mapa já mesclado (depois do reduce) e aponta
+// cidades com valores suspeitos. Não relê o arquivo: usa só os agregados.
+//
+//   - outlier: usa a soma dos quadrados (sumSquares) para calcular o
+//     desvio-padrão populacional de cada cidade e confere se min/max passam
+//     de média ± sigma*desvio. Precisa de pelo menos 2 medições.
+//   - few-samples: count < minSamples.
+//   - jump: maior diferença entre leituras consecutivas de uma cidade dentro
+//     do mesmo chunk (maxJump). Pares que caem na fronteira entre chunks não
+//     são vistos, já que os chunks são processados em paralelo e fora de ordem.
+func detectAnomalies(mapOfTemp map[string]cityTemperatureInfo, cfg anomalyConfig) []anomaly {
+	var found []anomaly
+	for city, info := range mapOfTemp {
+		if info.count < cfg.minSamples {
+			found = append(found, anomaly{
+				city:   city,
+				kind:   anomalyFewSamples,
+				detail: fmt.Sprintf("%d samples, expected at least %d", info.count, cfg.minSamples),
+			})
+		}
+
+		if info.count >= 2 && cfg.sigma > 0 {
+			mean, stddev := meanAndStddev(info)
+			if stddev > 0 {
+				low := mean - cfg.sigma*stddev
+				high := mean + cfg.sigma*stddev
+				if float64(info.min) < low {
+					found = append(found, anomaly{
+						city:   city,
+						kind:   anomalyOutlier,
+						detail: fmt.Sprintf("min %.1f below %.1f (mean %.1f, stddev %.1f)", float64(info.min)/10.0, low/10.0, mean/10.0, stddev/10.0),
+					})
+				}
+				if float64(info.max) > high {
+					found = append(found, anomaly{
+						city:   city,
+						kind:   anomalyOutlier,
+						detail: fmt.Sprintf("max %.1f above %.1f (mean %.1f, stddev %.1f)", float64(info.max)/10.0, high/10.0, mean/10.0, stddev/10.0),
+					})
+				}
+			}
+		}
+
+		if cfg.maxJump > 0 && info.maxJump > cfg.maxJump {
+			found = append(found, anomaly{
+				city:   city,
+				kind:   anomalyJump,
+				detail: fmt.Sprintf("consecutive readings differ by %.1f, limit is %.1f", float64(info.maxJump)/10.0, float64(cfg.maxJump)/10.0),
+			})
+		}
+	}
+
+	// Ordena por cidade e depois pelo texto, para a saída ser estável entre execuções.
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].city != found[j].city {
+			return found[i].city < found[j].city
+		}
+		if found[i].kind != found[j].kind {
+			return found[i].kind < found[j].kind
+		}
+		return found[i].detail < found[j].detail
+	})
+	return found
+}
+
+// meanAndStddev devolve média e desvio-padrão populacional em DÉCIMOS.
+// variância = E[x²] - E[x]²; o max(0, ...) protege contra erro de float negativo.
+func meanAndStddev(info cityTemperatureInfo) (mean, stddev float64) {
+	n := float64(info.count)
+	mean = float64(info.sum) / n
+	variance := float64(info.sumSquares)/n - mean*mean
+	return mean, math.Sqrt(max(0, variance))
+}
+
+// formatAnomalies monta a seção de texto do relatório, uma anomalia por linha.
+func formatAnomalies(found []anomaly) string {
+	var stringsBuilder strings.Builder
+	stringsBuilder.WriteString(fmt.Sprintf("Anomalies (%d):\n", len(found)))
+	for _, a := range found {
+		stringsBuilder.WriteString(fmt.Sprintf("%s: %s (%s)\n", a.city, a.kind, a.detail))
+	}
+	return stringsBuilder.String()
+}
+
+// writeAnomalies imprime a seção no stdout ou grava em arquivo quando path != "".
+func writeAnomalies(found []anomaly, path string) error {
+	report := formatAnomalies(found)
+	if path == "" {
+		fmt.Print(report)
+		return nil
+	}
+	return os.WriteFile(path, []byte(report), 0o644)
+}
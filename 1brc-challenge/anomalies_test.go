@@ -0,0 +1,101 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// infoOf agrega leituras em décimos do mesmo jeito que processReadChunk
+// faz com -anomalies ligado.
+func infoOf(readings ...int64) cityTemperatureInfo {
+	info := cityTemperatureInfo{min: readings[0], max: readings[0], last: readings[0]}
+	for _, temp := range readings {
+		info.count++
+		info.sum += temp
+		info.sumSquares += temp * temp
+		info.min = min(info.min, temp)
+		info.max = max(info.max, temp)
+		info.maxJump = max(info.maxJump, temp-info.last, info.last-temp)
+		info.last = temp
+	}
+	return info
+}
+
+func TestDetectAnomalies(t *testing.T) {
+	// Dez leituras de 20.0 e uma de 50.0: média 22.7, desvio 8.6.
+	spike := infoOf(200, 200, 200, 200, 200, 200, 200, 200, 200, 200, 500)
+
+	tests := []struct {
+		name string
+		data map[string]cityTemperatureInfo
+		cfg  anomalyConfig
+		want []string // "cidade:tipo"
+	}{
+		{"outlier", map[string]cityTemperatureInfo{"A": spike}, anomalyConfig{sigma: 3}, []string{"A:outlier"}},
+		{"outlier abaixo", map[string]cityTemperatureInfo{"A": infoOf(200, 200, 200, 200, 200, 200, 200, 200, 200, 200, -100)}, anomalyConfig{sigma: 3}, []string{"A:outlier"}},
+		{"dentro de sigma", map[string]cityTemperatureInfo{"A": spike}, anomalyConfig{sigma: 4}, nil},
+		{"sigma zero desliga", map[string]cityTemperatureInfo{"A": spike}, anomalyConfig{sigma: 0}, nil},
+		{"desvio zero", map[string]cityTemperatureInfo{"A": infoOf(150, 150, 150)}, anomalyConfig{sigma: 0.1}, nil},
+		{"uma medição só", map[string]cityTemperatureInfo{"A": infoOf(999)}, anomalyConfig{sigma: 0.1}, nil},
+		{"poucas medições", map[string]cityTemperatureInfo{"A": infoOf(10, 20), "B": infoOf(10, 20, 30)}, anomalyConfig{minSamples: 3}, []string{"A:few-samples"}},
+		{"salto", map[string]cityTemperatureInfo{"A": infoOf(100, 400, 390), "B": infoOf(100, 300)}, anomalyConfig{maxJump: 200}, []string{"A:jump"}},
+		{"salto desligado", map[string]cityTemperatureInfo{"A": infoOf(100, 400)}, anomalyConfig{}, nil},
+		{
+			"várias, ordenadas",
+			map[string]cityTemperatureInfo{"B": spike, "A": infoOf(-500, 500)},
+			anomalyConfig{sigma: 3, minSamples: 5, maxJump: 250},
+			[]string{"A:few-samples", "A:jump", "B:jump", "B:outlier"},
+		},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, a := range detectAnomalies(tt.data, tt.cfg) {
+			got = append(got, a.city+":"+a.kind)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: detectAnomalies = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMeanAndStddev(t *testing.T) {
+	mean, stddev := meanAndStddev(infoOf(100, 200, 300))
+	if mean != 200 || math.Abs(stddev-81.65) > 0.01 {
+		t.Errorf("meanAndStddev(10.0, 20.0, 30.0) = %.2f, %.2f, want 200, 81.65 (décimos)", mean, stddev)
+	}
+	// Leituras iguais podem dar variância levemente negativa no float.
+	if _, stddev := meanAndStddev(infoOf(333, 333, 333)); stddev != 0 {
+		t.Errorf("desvio de leituras iguais = %v, want 0", stddev)
+	}
+}
+
+// Com -anomalies o caminho que calcula sumSquares/last/maxJump é usado, e a
+// linha de resultado tem que continuar igual.
+func TestEvaluateWithAnomalies(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "measurements.txt")
+	data := "A;1.0\nB;5.0\nA;40.0\nB;5.5\nA;39.0\nB;6.0\nC;0.0\n"
+	if err := os.WriteFile(input, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	plain, found := evaluate(input, evaluateOptions{rounding: roundingExact})
+	if found != nil {
+		t.Errorf("sem -anomalies: found = %v", found)
+	}
+	cfg := anomalyConfig{minSamples: 2, maxJump: 100}
+	got, found := evaluate(input, evaluateOptions{rounding: roundingExact, anomalies: &cfg})
+	if got != plain {
+		t.Errorf("resultado com -anomalies = %q, want %q", got, plain)
+	}
+
+	var kinds []string
+	for _, a := range found {
+		kinds = append(kinds, a.city+":"+a.kind)
+	}
+	if want := []string{"A:jump", "C:few-samples"}; !reflect.DeepEqual(kinds, want) {
+		t.Errorf("anomalias = %v, want %v", kinds, want)
+	}
+}
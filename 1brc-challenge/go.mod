@@ -1,3 +1,5 @@
 module ibrc-challenge
 
 go 1.24.6
+
+require golang.org/x/text v0.30.0
@@ -15,75 +15,94 @@
 package main
 
 import (
-	"bytes"         // usado para achar o índice do último '\n' dentro do chunk lido
-	"errors"        // comparação de erros (ex.: io.EOF)
-	"flag"          // leitura de flags de CLI (ex.: -input, -cpuprofile)
-	"fmt"           // impressão formatada
-	"io"            // io.EOF e interfaces de leitura
-	"log"           // logs para erros ao criar perfis
-	"math"          // math.Round para arredondamento de 1 casa decimal
-	"os"            // acesso a arquivos e criação de perfis
-	"runtime"       // runtime.NumCPU, GC, etc.
-	"runtime/pprof" // perfis de CPU e memória (pprof)
-	"runtime/trace" // trace de execução (timeline)
-	"sort"          // ordenação da lista final de cidades
-	"strings"       // strings.Builder para construir a saída
-	"sync"          // WaitGroup para coordenar goroutines
-	"time"          // medição do tempo total de execução
+	"bytes"   // usado para achar o índice do último '\n' dentro do chunk lido
+	"errors"  // comparação de erros (ex.: io.EOF)
+	"flag"    // leitura de flags de CLI (ex.: -input, -cpuprofile)
+	"fmt"     // impressão formatada
+	"io"      // io.EOF e interfaces de leitura
+	"log"     // logs para erros fatais (flags inválidas, relatórios)
+	"math"    // math.Round para arredondamento de 1 casa decimal
+	"os"      // acesso a arquivos
+	"runtime" // runtime.NumCPU
+	"strings" // strings.Builder para construir a saída
+	"sync"    // WaitGroup para coordenar goroutines
+	"time"    // medição do tempo total de execução
 )
 
 // Flags globais (lidas em main via flag.Parse)
+// Perfis (ver profiling.go): o valor é o caminho completo do arquivo de saída.
 var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to `file`")
 var memprofile = flag.String("memprofile", "", "write memory profile to `file`")
+var executionprofile = flag.String("execprofile", "", "write trace execution to `file`")
+var blockprofile = flag.String("blockprofile", "", "write goroutine blocking profile to `file`")
+var mutexprofile = flag.String("mutexprofile", "", "write mutex contention profile to `file`")
+var goroutineprofile = flag.String("goroutineprofile", "", "write goroutine profile to `file` at the end of the run")
+var pprofAddr = flag.String("pprof-addr", "", "serve live pprof data on `host:port` (e.g. localhost:6060)")
 
-// Nota: "tarce" está com typo; é apenas mensagem de ajuda, não afeta execução.
-var executionprofile = flag.String("execprofile", "", "write tarce execution to `file`")
 var input = flag.String("input", "", "path to the input file to evaluate")
+var rounding = flag.String("rounding", roundingFloat, "rounding `mode` for min/avg/max: float or exact (official 1BRC spec)")
+
+// Flags de ordenação e limite da saída (ver report.go).
+var sortBy = flag.String("sort", sortByName, "sort stations by `key`: name, avg, min, max or count")
+var desc = flag.Bool("desc", false, "sort in descending order")
+var collation = flag.String("collate", "", "sort names with locale-aware collation for `locale` (e.g. pt-BR)")
+var top = flag.Int("top", 0, "print only the first `N` stations after sorting")
+var bottom = flag.Int("bottom", 0, "print only the last `N` stations after sorting")
+
+// Flags de normalização dos nomes de cidades (ver normalize.go).
+var normalize = flag.String("normalize", "", "comma-separated station name normalization `steps`: nfc, fold, spaces or all")
+var aliases = flag.String("aliases", "", "`file` with \"alias;canonical\" station names merged before aggregation")
+
+// Flags do relatório de anomalias (-anomalies).
+var anomalies = flag.Bool("anomalies", false, "print a report of stations with suspicious values")
+var anomaliesOut = flag.String("anomalies-out", "", "write the anomalies report to `file` instead of stdout")
+var anomalySigma = flag.Float64("anomaly-sigma", 3, "flag min/max farther than `N` standard deviations from the station mean (0 disables)")
+var anomalyMinSamples = flag.Int64("anomaly-min-samples", 2, "flag stations with fewer than `N` samples")
+var anomalyMaxJump = flag.Float64("anomaly-max-jump", 30, "flag consecutive readings of a station that differ by more than `degrees` (0 disables)")
 
 func main() {
 	start := time.Now() // marca o início para medir tempo total
 	flag.Parse()        // lê as flags passadas via CLI
 
-	// Se pediram trace (-execprofile), abrimos arquivo e iniciamos o trace.
-	if *executionprofile != "" {
-		f, err := os.Create("./profiles/" + *executionprofile)
-		if err != nil {
-			log.Fatal("could not create trace execution profile: ", err)
-		}
-		defer f.Close()
-		trace.Start(f)
-		defer trace.Stop()
+	// Valida as flags antes de começar a ler o arquivo.
+	if err := validateRoundingMode(*rounding); err != nil {
+		log.Fatal(err)
+	}
+	report := reportConfig{sortBy: *sortBy, desc: *desc, collate: *collation, top: *top, bottom: *bottom}
+	if err := report.validate(); err != nil {
+		log.Fatal(err)
+	}
+	normalizer, err := newStationNormalizer(*normalize, *aliases)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	// Se pediram pprof de CPU (-cpuprofile), iniciamos/stoppamos o perfil.
-	if *cpuprofile != "" {
-		f, err := os.Create("./profiles/" + *cpuprofile)
-		if err != nil {
-			log.Fatal("could not create CPU profile: ", err)
-		}
-		defer f.Close()
-		if err := pprof.StartCPUProfile(f); err != nil {
-			log.Fatal("could not start CPU profile: ", err)
+	// Liga os perfis pedidos via flags; stopProfiling grava os arquivos no fim.
+	stopProfiling := startProfiling()
+
+	opts := evaluateOptions{rounding: *rounding, report: report, normalizer: normalizer}
+	if *anomalies || *anomaliesOut != "" {
+		opts.anomalies = &anomalyConfig{
+			sigma:      *anomalySigma,
+			minSamples: *anomalyMinSamples,
+			maxJump:    int64(math.Round(*anomalyMaxJump * 10)), // graus -> décimos
 		}
-		defer pprof.StopCPUProfile()
 	}
 
 	// Executa a lógica principal: leitura, parsing concorrente e agregação
-	evaluate(*input)
+	result, found := evaluate(*input, opts)
+	fmt.Println(result)
 
-	// Se pediram pprof de memória (-memprofile), força um GC e escreve o heap profile.
-	if *memprofile != "" {
-		f, err := os.Create("./profiles/" + *memprofile)
-		if err != nil {
-			log.Fatal("could not create memory profile: ", err)
-		}
-		defer f.Close()
-		runtime.GC()
-		if err := pprof.WriteHeapProfile(f); err != nil {
-			log.Fatal("could not write memory profile: ", err)
+	// Relatório de anomalias como seção separada (ou arquivo, com -anomalies-out).
+	if opts.anomalies != nil {
+		if err := writeAnomalies(found, *anomaliesOut); err != nil {
+			log.Fatal("could not write anomalies report: ", err)
 		}
 	}
 
+	// Para CPU/trace e grava memória, block, mutex e goroutine profiles.
+	stopProfiling()
+
 	// Tempo total
 	fmt.Printf("Execution time: %s\n", time.Since(start))
 }
@@ -92,37 +111,65 @@ func main() {
 type computedResult struct {
 	city          string
 	min, max, avg float64
+	count         int64
+}
+
+// evaluateOptions agrupa as opções de CLI que mudam o cálculo/saída de evaluate.
+type evaluateOptions struct {
+	rounding   string             // modo de arredondamento (ver rounding.go)
+	report     reportConfig       // ordenação e top/bottom da saída (ver report.go)
+	anomalies  *anomalyConfig     // nil = não detecta anomalias
+	normalizer *stationNormalizer // nil = usa os nomes exatamente como vieram no arquivo
 }
 
 // evaluate coordena o fluxo alto nível:
 // - chama o leitor/paralelizador para obter o mapa final (por cidade),
 // - converte para slice, calcula médias em float, arredonda,
-// - ordena por nome e formata a string de saída.
-func evaluate(input string) string {
-	mapOfTemp, err := readFileLineByLineIntoAMap(input)
+// - ordena (por nome, por padrão), aplica top/bottom e formata a string de saída,
+// - se pedido, detecta anomalias sobre o mesmo mapa (ver anomalies.go).
+func evaluate(input string, opts evaluateOptions) (string, []anomaly) {
+	mapOfTemp, err := readFileLineByLineIntoAMap(input, opts.normalizer, opts.anomalies != nil)
 	if err != nil {
 		panic(err)
 	}
 
+	var found []anomaly
+	if opts.anomalies != nil {
+		found = detectAnomalies(mapOfTemp, *opts.anomalies)
+	}
+
 	// Converte o mapa agregado em slice para ordenar e imprimir
 	resultArr := make([]computedResult, len(mapOfTemp))
 	var count int
 	for city, calculated := range mapOfTemp {
-		resultArr[count] = computedResult{
-			city: city,
-			// min/max/sum estão em décimos (int).
-			// Convertemos para float e arredondamos para 1 casa decimal na saída.
-			min: round(float64(calculated.min) / 10.0),
-			max: round(float64(calculated.max) / 10.0),
-			avg: round(float64(calculated.sum) / 10.0 / float64(calculated.count)),
+		if opts.rounding == roundingExact {
+			// Modo da especificação: tudo em inteiros (décimos), só vira float na saída.
+			resultArr[count] = computedResult{
+				city:  city,
+				min:   tenthsToFloat(calculated.min),
+				max:   tenthsToFloat(calculated.max),
+				avg:   tenthsToFloat(averageTenths(calculated.sum, calculated.count)),
+				count: calculated.count,
+			}
+		} else {
+			resultArr[count] = computedResult{
+				city: city,
+				// min/max/sum estão em décimos (int).
+				// Convertemos para float e arredondamos para 1 casa decimal na saída.
+				min:   round(float64(calculated.min) / 10.0),
+				max:   round(float64(calculated.max) / 10.0),
+				avg:   round(float64(calculated.sum) / 10.0 / float64(calculated.count)),
+				count: calculated.count,
+			}
 		}
 		count++
 	}
 
-	// Ordena alfabeticamente por cidade
-	sort.Slice(resultArr, func(i, j int) bool {
-		return resultArr[i].city < resultArr[j].city
-	})
+	// Ordena (alfabeticamente por cidade, por padrão) e corta em top/bottom
+	resultArr = sortAndLimit(resultArr, opts.report)
+	if len(resultArr) == 0 {
+		return "", found
+	}
 
 	// Monta a linha final (ex.: "City=10.2/15.3/22.1, ...")
 	var stringsBuilder strings.Builder
@@ -130,16 +177,24 @@ func evaluate(input string) string {
 		stringsBuilder.WriteString(fmt.Sprintf("%s=%.1f/%.1f/%.1f, ", i.city, i.min, i.avg, i.max))
 	}
 	// Remove a ", " final cortando os últimos 2 caracteres.
-	return stringsBuilder.String()[:stringsBuilder.Len()-2]
+	return stringsBuilder.String()[:stringsBuilder.Len()-2], found
 }
 
 // cityTemperatureInfo guarda as estatísticas por cidade.
 // Importante: usamos int64 em DÉCIMOS (ex.: 24.3 -> 243) para evitar custo com float durante parsing/acúmulo.
+//
+// sumSquares e maxJump só alimentam o relatório de anomalias e ficam zerados sem -anomalies:
+//   - sumSquares: soma dos quadrados (em décimos²), para o desvio-padrão.
+//   - last/maxJump: última leitura vista no chunk e maior salto entre leituras seguidas.
+//     Depois do reduce, "last" não tem mais significado (chunks chegam fora de ordem).
 type cityTemperatureInfo struct {
-	count int64
-	min   int64
-	max   int64
-	sum   int64
+	count      int64
+	min        int64
+	max        int64
+	sum        int64
+	sumSquares int64
+	last       int64
+	maxJump    int64
 }
 
 // readFileLineByLineIntoAMap faz todo o pipeline de I/O e paralelização:
@@ -157,9 +212,9 @@ type cityTemperatureInfo struct {
 //   - mantém o restante (após o último '\n') como novo leftover.
 //
 // 5) Quando termina, fecha chunkStream, espera workers (wg.Wait) e fecha resultStream.
-// 6) Consome resultStream e faz o "reduce" no mapa global.
+// 6) Consome resultStream e faz o "reduce" no mapa global (normalizando os nomes antes, se normalizer != nil).
 // 7) Retorna o mapa final.
-func readFileLineByLineIntoAMap(filepath string) (map[string]cityTemperatureInfo, error) {
+func readFileLineByLineIntoAMap(filepath string, normalizer *stationNormalizer, trackAnomalies bool) (map[string]cityTemperatureInfo, error) {
 	file, err := os.Open(filepath)
 	if err != nil {
 		panic(err) // aqui preferiram panicar; poderia retornar err para o caller decidir
@@ -181,12 +236,13 @@ func readFileLineByLineIntoAMap(filepath string) (map[string]cityTemperatureInfo
 
 	// -------------- POOL DE WORKERS --------------
 	// Lança N-1 workers (deixa 1 core para o produtor I/O).
-	for i := 0; i < runtime.NumCPU()-1; i++ {
+	// Em máquinas com 1 core ainda precisamos de pelo menos 1 worker.
+	for i := 0; i < max(1, runtime.NumCPU()-1); i++ {
 		wg.Add(1)
 		go func() {
 			// Cada worker consome chunks e manda mapa parcial no resultStream.
 			for chunk := range chunkStream {
-				processReadChunk(chunk, resultStream)
+				processReadChunk(chunk, resultStream, trackAnomalies)
 			}
 			wg.Done()
 		}()
@@ -240,10 +296,18 @@ func readFileLineByLineIntoAMap(filepath string) (map[string]cityTemperatureInfo
 	// Consome mapas parciais de cada chunk e mescla em mapOfTemp.
 	for t := range resultStream {
 		for city, tempInfo := range t {
+			// Nomes diferentes (NFD/NFC, maiúsculas, apelidos...) caem na mesma chave.
+			if normalizer != nil {
+				city = normalizer.normalize(city)
+			}
 			if val, ok := mapOfTemp[city]; ok {
 				// Se a cidade já existe no mapa global, acumula:
 				val.count += tempInfo.count
 				val.sum += tempInfo.sum
+				val.sumSquares += tempInfo.sumSquares
+				if tempInfo.maxJump > val.maxJump {
+					val.maxJump = tempInfo.maxJump
+				}
 				if tempInfo.min < val.min {
 					val.min = tempInfo.min
 				}
@@ -258,6 +322,11 @@ func readFileLineByLineIntoAMap(filepath string) (map[string]cityTemperatureInfo
 		}
 	}
 
+	// Com -normalize/-aliases a saída usa o nome de exibição, não a chave normalizada.
+	if normalizer != nil {
+		mapOfTemp = normalizer.displayNames(mapOfTemp)
+	}
+
 	return mapOfTemp, nil
 }
 
@@ -270,7 +339,10 @@ func readFileLineByLineIntoAMap(filepath string) (map[string]cityTemperatureInfo
 //	city;temp\n
 //
 // onde "temp" é texto do tipo -12.3, 0.0, 25.4 etc. (uma casa decimal).
-func processReadChunk(buf []byte, resultStream chan<- map[string]cityTemperatureInfo) {
+//
+// Com trackAnomalies == false fica só a agregação simples (count/min/max/sum);
+// sumSquares, last e maxJump só são calculados quando -anomalies está ligado.
+func processReadChunk(buf []byte, resultStream chan<- map[string]cityTemperatureInfo, trackAnomalies bool) {
 	toSend := make(map[string]cityTemperatureInfo) // mapa parcial local do worker
 	var start int                                  // índice onde começa o campo atual na string
 	var city string                                // cidade atual (capturada antes do ';')
@@ -304,15 +376,32 @@ func processReadChunk(buf []byte, resultStream chan<- map[string]cityTemperature
 					if temp > val.max {
 						val.max = temp
 					}
+					if trackAnomalies {
+						val.sumSquares += temp * temp
+						// Salto em relação à leitura anterior da mesma cidade neste chunk.
+						jump := temp - val.last
+						if jump < 0 {
+							jump = -jump
+						}
+						if jump > val.maxJump {
+							val.maxJump = jump
+						}
+						val.last = temp
+					}
 					toSend[city] = val
 				} else {
 					// Primeira ocorrência da cidade neste chunk
-					toSend[city] = cityTemperatureInfo{
+					info := cityTemperatureInfo{
 						count: 1,
 						min:   temp,
 						max:   temp,
 						sum:   temp,
 					}
+					if trackAnomalies {
+						info.sumSquares = temp * temp
+						info.last = temp
+					}
+					toSend[city] = info
 				}
 				// Limpa city para a próxima linha
 				city = ""
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Passos aceitos pela flag -normalize (separados por vírgula, ou "all").
+const (
+	normalizeNFC    = "nfc"    // compõe acentos: "São" (NFD) e "São" (NFC) viram a mesma chave
+	normalizeFold   = "fold"   // case folding: "SÃO_PAULO" e "são_paulo" viram a mesma chave (a saída mantém as maiúsculas)
+	normalizeSpaces = "spaces" // espaços/underscores repetidos viram um único "_": "São Paulo" -> "São_Paulo"
+	normalizeAll    = "all"
+)
+
+// stationNormalizer canoniza nomes de cidades antes de entrarem no mapa global.
+//
+// É usado só no reduce (uma única goroutine), então o cache e o caser
+// não precisam de lock. Cada nome distinto é normalizado uma vez só:
+// no hot path (processReadChunk) nada muda.
+//
+// A chave normalizada só serve para juntar as cidades; na saída aparece o
+// nome de exibição (ver displayNames), para "fold" não imprimir tudo em
+// minúsculas.
+type stationNormalizer struct {
+	nfc, fold, spaces bool
+	caser             cases.Caser
+	aliases           map[string]string // nome normalizado -> chave canônica
+	cache             map[string]string // nome bruto -> chave
+	display           map[string]string // chave -> nome de exibição
+}
+
+// newStationNormalizer monta o normalizador a partir das flags.
+// Devolve nil quando nenhum passo foi pedido (fluxo original, sem custo extra).
+func newStationNormalizer(steps string, aliasFile string) (*stationNormalizer, error) {
+	if steps == "" && aliasFile == "" {
+		return nil, nil
+	}
+
+	n := &stationNormalizer{
+		caser:   cases.Fold(),
+		cache:   make(map[string]string),
+		display: make(map[string]string),
+	}
+	for _, step := range strings.Split(steps, ",") {
+		switch strings.TrimSpace(step) {
+		case "":
+		case normalizeNFC:
+			n.nfc = true
+		case normalizeFold:
+			n.fold = true
+		case normalizeSpaces:
+			n.spaces = true
+		case normalizeAll:
+			n.nfc, n.fold, n.spaces = true, true, true
+		default:
+			return nil, fmt.Errorf("unknown normalization step %q (expected %s, %s, %s or %s)",
+				step, normalizeNFC, normalizeFold, normalizeSpaces, normalizeAll)
+		}
+	}
+
+	if aliasFile != "" {
+		aliases, err := n.loadAliases(aliasFile)
+		if err != nil {
+			return nil, err
+		}
+		n.aliases = aliases
+	}
+	return n, nil
+}
+
+// loadAliases lê um arquivo no mesmo formato do dataset: "apelido;nome canônico".
+// Linhas vazias e começando com '#' são ignoradas. Os dois lados passam pelos
+// mesmos passos de normalização, para o apelido casar com a chave já normalizada;
+// o nome canônico, como foi escrito (sem o case folding), vira o nome de exibição.
+func (n *stationNormalizer) loadAliases(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open alias file: %w", err)
+	}
+	defer file.Close()
+
+	aliases := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		alias, canonical, ok := strings.Cut(line, ";")
+		if !ok || alias == "" || canonical == "" {
+			return nil, fmt.Errorf("%s:%d: expected \"alias;canonical\"", path, lineNumber)
+		}
+		key := n.apply(canonical)
+		aliases[n.apply(alias)] = key
+		n.display[key] = n.applySteps(strings.TrimSpace(canonical), false)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read alias file: %w", err)
+	}
+	return aliases, nil
+}
+
+// normalize devolve a chave canônica de uma cidade (com cache por nome bruto).
+// O primeiro nome bruto visto de cada chave vira seu nome de exibição, a
+// menos que um apelido já tenha definido o nome canônico.
+func (n *stationNormalizer) normalize(city string) string {
+	if normalized, ok := n.cache[city]; ok {
+		return normalized
+	}
+	normalized := n.apply(city)
+	if canonical, ok := n.aliases[normalized]; ok {
+		normalized = canonical
+	}
+	if _, ok := n.display[normalized]; !ok {
+		n.display[normalized] = n.applySteps(city, false)
+	}
+	n.cache[city] = normalized
+	return normalized
+}
+
+// displayNames troca as chaves do mapa final pelos nomes de exibição.
+// Chaves diferentes nunca têm o mesmo nome de exibição, já que ele volta
+// para a própria chave ao ser normalizado.
+func (n *stationNormalizer) displayNames(byKey map[string]cityTemperatureInfo) map[string]cityTemperatureInfo {
+	byName := make(map[string]cityTemperatureInfo, len(byKey))
+	for key, info := range byKey {
+		name, ok := n.display[key]
+		if !ok {
+			name = key
+		}
+		byName[name] = info
+	}
+	return byName
+}
+
+// apply executa os passos ligados, nesta ordem: NFC, case folding, espaços.
+func (n *stationNormalizer) apply(city string) string {
+	return n.applySteps(city, n.fold)
+}
+
+// applySteps é o apply com o case folding opcional; sem ele, dá o nome de exibição.
+func (n *stationNormalizer) applySteps(city string, fold bool) string {
+	if n.nfc {
+		city = norm.NFC.String(city)
+	}
+	if fold {
+		city = n.caser.String(city)
+	}
+	if n.spaces {
+		city = strings.Join(strings.FieldsFunc(city, func(r rune) bool {
+			return r == '_' || unicode.IsSpace(r)
+		}), "_")
+	}
+	return city
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Com fold, a chave em minúsculas só junta as cidades; a saída mostra o nome
+// canônico do apelido ou o primeiro nome bruto visto.
+func TestNormalizerDisplayNames(t *testing.T) {
+	aliasFile := filepath.Join(t.TempDir(), "aliases.txt")
+	if err := os.WriteFile(aliasFile, []byte("Floripa;Florianópolis\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	n, err := newStationNormalizer(normalizeFold, aliasFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byKey := map[string]cityTemperatureInfo{}
+	for _, raw := range []string{"São_Paulo", "SÃO_PAULO", "FLORIPA", "florianópolis"} {
+		info := byKey[n.normalize(raw)]
+		info.count++
+		byKey[n.normalize(raw)] = info
+	}
+
+	got := n.displayNames(byKey)
+	want := map[string]int64{"São_Paulo": 2, "Florianópolis": 2}
+	if len(got) != len(want) {
+		t.Fatalf("displayNames = %v, want keys %v", got, want)
+	}
+	for name, count := range want {
+		if got[name].count != count {
+			t.Errorf("%s: count %d, want %d", name, got[name].count, count)
+		}
+	}
+}
+
+// Cada passo sozinho e todos juntos; sem o passo, os nomes continuam separados.
+func TestNormalizerSteps(t *testing.T) {
+	const nfd, nfc = "Sa\u0303o_Paulo", "S\u00e3o_Paulo"
+
+	tests := []struct {
+		steps    string
+		a, b     string
+		sameKey  bool
+		wantName string // nome de exibição de a
+	}{
+		{normalizeNFC, nfd, nfc, true, nfc},
+		{normalizeFold, nfd, nfc, false, nfd},
+		{normalizeSpaces, "São Paulo", "São_Paulo", true, "São_Paulo"},
+		{normalizeSpaces, "  São \t Paulo__", "São_Paulo", true, "São_Paulo"},
+		{normalizeNFC, "São Paulo", "São_Paulo", false, "São Paulo"},
+		{normalizeAll, "SÃO  PAULO", "são_paulo", true, "SÃO_PAULO"},
+	}
+	for _, tt := range tests {
+		n, err := newStationNormalizer(tt.steps, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyA, keyB := n.normalize(tt.a), n.normalize(tt.b)
+		if (keyA == keyB) != tt.sameKey {
+			t.Errorf("-normalize %s: %q -> %q, %q -> %q, want same key %v", tt.steps, tt.a, keyA, tt.b, keyB, tt.sameKey)
+		}
+		if got := n.display[keyA]; got != tt.wantName {
+			t.Errorf("-normalize %s: nome de exibição de %q = %q, want %q", tt.steps, tt.a, got, tt.wantName)
+		}
+	}
+}
+
+func TestNormalizerUnknownStep(t *testing.T) {
+	if _, err := newStationNormalizer("nfc,trim", ""); err == nil {
+		t.Error("passo desconhecido aceito")
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	_ "net/http/pprof" // registra /debug/pprof/* no http.DefaultServeMux
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// startProfiling liga todos os perfis pedidos via flags e devolve a função
+// que deve ser chamada no fim da execução para pará-los e gravar os arquivos.
+//
+// Os destinos são caminhos completos (relativos ao diretório atual ou absolutos);
+// o diretório pai é criado se ainda não existir.
+//
+//   - -execprofile / -cpuprofile: começam agora e param no stop.
+//   - -blockprofile / -mutexprofile: ligam a amostragem agora e gravam no stop.
+//   - -memprofile / -goroutineprofile: são "fotos" tiradas no stop.
+//   - -pprof-addr: sobe o endpoint HTTP /debug/pprof/ para inspecionar ao vivo.
+func startProfiling() (stop func()) {
+	var stops []func()
+
+	// Endpoint ao vivo: útil em execuções longas (ex.: go tool pprof http://addr/debug/pprof/profile).
+	if *pprofAddr != "" {
+		go func() {
+			log.Printf("pprof listening on http://%s/debug/pprof/", *pprofAddr)
+			if err := http.ListenAndServe(*pprofAddr, nil); err != nil {
+				log.Print("pprof server stopped: ", err)
+			}
+		}()
+	}
+
+	// Se pediram trace (-execprofile), abrimos arquivo e iniciamos o trace.
+	if *executionprofile != "" {
+		f := createProfileFile(*executionprofile, "trace execution")
+		if err := trace.Start(f); err != nil {
+			log.Fatal("could not start trace execution profile: ", err)
+		}
+		stops = append(stops, func() {
+			trace.Stop()
+			f.Close()
+		})
+	}
+
+	// Se pediram pprof de CPU (-cpuprofile), iniciamos/stoppamos o perfil.
+	if *cpuprofile != "" {
+		f := createProfileFile(*cpuprofile, "CPU")
+		if err := pprof.StartCPUProfile(f); err != nil {
+			log.Fatal("could not start CPU profile: ", err)
+		}
+		stops = append(stops, func() {
+			pprof.StopCPUProfile()
+			f.Close()
+		})
+	}
+
+	// Block/mutex só coletam amostras se a taxa for ligada antes da execução.
+	if *blockprofile != "" {
+		runtime.SetBlockProfileRate(1)
+		stops = append(stops, func() { writeLookupProfile("block", *blockprofile) })
+	}
+	if *mutexprofile != "" {
+		runtime.SetMutexProfileFraction(1)
+		stops = append(stops, func() { writeLookupProfile("mutex", *mutexprofile) })
+	}
+
+	if *goroutineprofile != "" {
+		stops = append(stops, func() { writeLookupProfile("goroutine", *goroutineprofile) })
+	}
+
+	// Se pediram pprof de memória (-memprofile), força um GC e escreve o heap profile.
+	if *memprofile != "" {
+		stops = append(stops, func() {
+			f := createProfileFile(*memprofile, "memory")
+			defer f.Close()
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				log.Fatal("could not write memory profile: ", err)
+			}
+		})
+	}
+
+	// Executa em ordem inversa, como os defers faziam: primeiro as "fotos",
+	// por último param CPU e trace.
+	return func() {
+		for i := len(stops) - 1; i >= 0; i-- {
+			stops[i]()
+		}
+	}
+}
+
+// createProfileFile cria o arquivo de perfil no caminho pedido,
+// criando os diretórios intermediários se faltar algum.
+func createProfileFile(path, kind string) *os.File {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		log.Fatalf("could not create directory for %s profile: %v", kind, err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatalf("could not create %s profile: %v", kind, err)
+	}
+	return f
+}
+
+// writeLookupProfile grava um dos perfis nomeados do runtime (block, mutex, goroutine...).
+func writeLookupProfile(name, path string) {
+	f := createProfileFile(path, name)
+	defer f.Close()
+	if err := pprof.Lookup(name).WriteTo(f, 0); err != nil {
+		log.Fatalf("could not write %s profile: %v", name, err)
+	}
+}
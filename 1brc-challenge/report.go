@@ -0,0 +1,96 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"sort"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Chaves aceitas pela flag -sort.
+const (
+	sortByName  = "name"
+	sortByAvg   = "avg"
+	sortByMin   = "min"
+	sortByMax   = "max"
+	sortByCount = "count"
+)
+
+// reportConfig controla a ordem e o tamanho da lista final de cidades.
+type reportConfig struct {
+	sortBy  string
+	desc    bool
+	collate string // tag de idioma (ex.: "pt-BR"); vazio = ordem crua de bytes
+	top     int    // mantém só as N primeiras depois de ordenar (0 = todas)
+	bottom  int    // mantém só as N últimas depois de ordenar (0 = todas)
+}
+
+// validate confere as combinações de flags antes de ler o arquivo.
+func (cfg reportConfig) validate() error {
+	switch cfg.sortBy {
+	case sortByName, sortByAvg, sortByMin, sortByMax, sortByCount:
+	default:
+		return fmt.Errorf("unknown sort key %q (expected %s, %s, %s, %s or %s)",
+			cfg.sortBy, sortByName, sortByAvg, sortByMin, sortByMax, sortByCount)
+	}
+	if cfg.top < 0 || cfg.bottom < 0 {
+		return fmt.Errorf("-top and -bottom must not be negative")
+	}
+	if cfg.top > 0 && cfg.bottom > 0 {
+		return fmt.Errorf("-top and -bottom cannot be used together")
+	}
+	if cfg.collate != "" {
+		if _, err := language.Parse(cfg.collate); err != nil {
+			return fmt.Errorf("invalid collation locale %q: %w", cfg.collate, err)
+		}
+	}
+	return nil
+}
+
+// sortAndLimit ordena o slice de resultados conforme cfg e aplica top/bottom.
+//
+// Empates na chave numérica são desempatados pelo nome (sempre crescente),
+// para a saída ser estável entre execuções. Com -collate, nomes acentuados
+// ficam junto das letras base ("Évora" perto de "Evora", não depois de "Z").
+func sortAndLimit(resultArr []computedResult, cfg reportConfig) []computedResult {
+	compareNames := func(a, b string) int { return cmp.Compare(a, b) }
+	if cfg.collate != "" {
+		collator := collate.New(language.Make(cfg.collate))
+		compareNames = collator.CompareString
+	}
+
+	sort.Slice(resultArr, func(i, j int) bool {
+		a, b := resultArr[i], resultArr[j]
+		var c int
+		switch cfg.sortBy {
+		case sortByAvg:
+			c = cmp.Compare(a.avg, b.avg)
+		case sortByMin:
+			c = cmp.Compare(a.min, b.min)
+		case sortByMax:
+			c = cmp.Compare(a.max, b.max)
+		case sortByCount:
+			c = cmp.Compare(a.count, b.count)
+		}
+		if c == 0 && cfg.sortBy == sortByName {
+			c = compareNames(a.city, b.city)
+		}
+		if cfg.desc {
+			c = -c
+		}
+		if c == 0 {
+			c = compareNames(a.city, b.city)
+		}
+		return c < 0
+	})
+
+	if cfg.top > 0 && cfg.top < len(resultArr) {
+		resultArr = resultArr[:cfg.top]
+	}
+	if cfg.bottom > 0 && cfg.bottom < len(resultArr) {
+		resultArr = resultArr[len(resultArr)-cfg.bottom:]
+	}
+	return resultArr
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// cidades monta o slice de entrada; sortAndLimit ordena no lugar, então
+// cada caso recebe uma cópia nova.
+func cidades() []computedResult {
+	return []computedResult{
+		{city: "C", min: 0, avg: 7, max: 10, count: 3},
+		{city: "A", min: 1, avg: 5, max: 9, count: 3},
+		{city: "D", min: 3, avg: 4, max: 9, count: 1},
+		{city: "B", min: 2, avg: 5, max: 8, count: 5},
+	}
+}
+
+func nomes(results []computedResult) string {
+	var names []string
+	for _, r := range results {
+		names = append(names, r.city)
+	}
+	return strings.Join(names, " ")
+}
+
+// Empates (avg 5 de A e B, max 9 de A e D, count 3 de A e C) saem sempre
+// por nome crescente, mesmo com -desc.
+func TestSortAndLimit(t *testing.T) {
+	tests := []struct {
+		cfg  reportConfig
+		want string
+	}{
+		{reportConfig{sortBy: sortByName}, "A B C D"},
+		{reportConfig{sortBy: sortByName, desc: true}, "D C B A"},
+		{reportConfig{sortBy: sortByAvg}, "D A B C"},
+		{reportConfig{sortBy: sortByAvg, desc: true}, "C A B D"},
+		{reportConfig{sortBy: sortByMin}, "C A B D"},
+		{reportConfig{sortBy: sortByMin, desc: true}, "D B A C"},
+		{reportConfig{sortBy: sortByMax}, "B A D C"},
+		{reportConfig{sortBy: sortByMax, desc: true}, "C A D B"},
+		{reportConfig{sortBy: sortByCount}, "D A C B"},
+		{reportConfig{sortBy: sortByCount, desc: true}, "B A C D"},
+		{reportConfig{sortBy: sortByAvg, desc: true, top: 2}, "C A"},
+		{reportConfig{sortBy: sortByAvg, bottom: 2}, "B C"},
+		{reportConfig{sortBy: sortByName, top: 10}, "A B C D"},
+		{reportConfig{sortBy: sortByName, bottom: 10}, "A B C D"},
+	}
+	for _, tt := range tests {
+		if got := nomes(sortAndLimit(cidades(), tt.cfg)); got != tt.want {
+			t.Errorf("sortAndLimit(%+v) = %q, want %q", tt.cfg, got, tt.want)
+		}
+	}
+}
+
+// Sem -collate a ordem é de bytes e "Évora" vai para depois de "Zurich";
+// com pt-BR ela fica ao lado de "Evora".
+func TestSortAndLimitCollate(t *testing.T) {
+	input := func() []computedResult {
+		return []computedResult{{city: "Zurich"}, {city: "Évora"}, {city: "Faro"}, {city: "Evora"}}
+	}
+	tests := []struct {
+		collate, want string
+	}{
+		{"", "Evora Faro Zurich Évora"},
+		{"pt-BR", "Evora Évora Faro Zurich"},
+	}
+	for _, tt := range tests {
+		if got := nomes(sortAndLimit(input(), reportConfig{sortBy: sortByName, collate: tt.collate})); got != tt.want {
+			t.Errorf("-collate %q: %q, want %q", tt.collate, got, tt.want)
+		}
+	}
+}
+
+func TestReportConfigValidate(t *testing.T) {
+	tests := []struct {
+		cfg reportConfig
+		ok  bool
+	}{
+		{reportConfig{sortBy: sortByName}, true},
+		{reportConfig{sortBy: sortByCount, desc: true, top: 5, collate: "pt-BR"}, true},
+		{reportConfig{sortBy: "city"}, false},
+		{reportConfig{sortBy: sortByName, top: 3, bottom: 3}, false},
+		{reportConfig{sortBy: sortByName, top: -1}, false},
+		{reportConfig{sortBy: sortByName, bottom: -1}, false},
+		{reportConfig{sortBy: sortByName, collate: "not a locale!"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.validate(); (err == nil) != tt.ok {
+			t.Errorf("validate(%+v) = %v, want ok %v", tt.cfg, err, tt.ok)
+		}
+	}
+}
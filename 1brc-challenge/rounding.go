@@ -0,0 +1,62 @@
+package main
+
+import "fmt"
+
+// Modos de arredondamento aceitos pela flag -rounding.
+//
+//   - "float": comportamento original, média em float64 + math.Round
+//     (arredonda empates para longe do zero: -0.05 -> -0.1).
+//   - "exact": segue a especificação oficial do 1BRC (Math.round do Java),
+//     calculando a média com aritmética inteira em décimos e arredondando
+//     empates para cima, em direção a +infinito (-0.05 -> 0.0, 0.05 -> 0.1).
+const (
+	roundingFloat = "float"
+	roundingExact = "exact"
+)
+
+// validateRoundingMode confere se o valor passado em -rounding é conhecido.
+func validateRoundingMode(mode string) error {
+	switch mode {
+	case roundingFloat, roundingExact:
+		return nil
+	}
+	return fmt.Errorf("unknown rounding mode %q (expected %q or %q)", mode, roundingFloat, roundingExact)
+}
+
+// averageTenths devolve a média sum/count já arredondada para décimos,
+// usando só inteiros (sum está em décimos, como em cityTemperatureInfo).
+//
+// O arredondamento é "half-up" igual ao Math.round do Java: floor(x + 0.5).
+// Como x = sum/count, isso vira floor((2*sum + count) / (2*count)),
+// com divisão que arredonda para baixo também para números negativos.
+//
+// Casos de borda conhecidos (sum em décimos, count, resultado em décimos):
+//
+//	-1, 2 -> 0    (-0.05 vira 0.0, e não -0.1 como no math.Round)
+//	 1, 2 -> 1    ( 0.05 vira 0.1)
+//	-3, 2 -> -1   (-0.15 vira -0.1)
+//	 3, 2 -> 2    ( 0.15 vira 0.2; em float 0.15*10 pode cair em 1.4999...)
+//	-5, 2 -> -2   (-0.25 vira -0.2)
+//	 1, 3 -> 0    ( 0.0333... vira 0.0)
+//	-2, 3 -> -1   (-0.0666... vira -0.1)
+//	 999, 1 -> 999 e -999, 1 -> -999 (extremos do dataset)
+func averageTenths(sum, count int64) int64 {
+	return floorDiv(2*sum+count, 2*count)
+}
+
+// floorDiv faz a divisão inteira arredondando para -infinito
+// (o "/" do Go trunca em direção ao zero).
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+// tenthsToFloat converte um valor inteiro em décimos para float64.
+// Como o valor já está arredondado, o "%.1f" da saída imprime o dígito exato
+// e 0 nunca vira "-0.0".
+func tenthsToFloat(tenths int64) float64 {
+	return float64(tenths) / 10.0
+}
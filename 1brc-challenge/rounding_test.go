@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Casos de borda do arredondamento exato (sum em décimos, count, média em décimos).
+func TestAverageTenths(t *testing.T) {
+	tests := []struct {
+		sum, count, want int64
+	}{
+		{-1, 2, 0},  // -0.05 vira 0.0, e não -0.1
+		{1, 2, 1},   //  0.05 vira 0.1
+		{-3, 2, -1}, // -0.15 vira -0.1
+		{3, 2, 2},   //  0.15 vira 0.2
+		{-5, 2, -2}, // -0.25 vira -0.2
+		{1, 3, 0},   //  0.0333... vira 0.0
+		{-2, 3, -1}, // -0.0666... vira -0.1
+		{999, 1, 999},
+		{-999, 1, -999},
+	}
+	for _, tt := range tests {
+		if got := averageTenths(tt.sum, tt.count); got != tt.want {
+			t.Errorf("averageTenths(%d, %d) = %d, want %d", tt.sum, tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestFloorDiv(t *testing.T) {
+	tests := []struct {
+		a, b, want int64
+	}{
+		{-1, 2, -1},
+		{1, 2, 0},
+		{-3, 2, -2},
+		{3, 2, 1},
+		{-5, 2, -3},
+		{-2, 3, -1},
+		{999, 1, 999},
+		{-999, 1, -999},
+		{4, -2, -2},
+		{-4, 2, -2},
+	}
+	for _, tt := range tests {
+		if got := floorDiv(tt.a, tt.b); got != tt.want {
+			t.Errorf("floorDiv(%d, %d) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// Uma cidade com -0.1 e 0.0 tem média -0.05: o modo exato dá 0.0 e o float, -0.1.
+func TestEvaluateRoundingModesDiffer(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "measurements.txt")
+	if err := os.WriteFile(input, []byte("X;-0.1\nX;0.0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		mode, want string
+	}{
+		{roundingExact, "X=-0.1/0.0/0.0"},
+		{roundingFloat, "X=-0.1/-0.1/0.0"},
+	}
+	for _, tt := range tests {
+		got, _ := evaluate(input, evaluateOptions{rounding: tt.mode})
+		if got != tt.want {
+			t.Errorf("evaluate(-rounding %s) = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
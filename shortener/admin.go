@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"shortener/api"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const keysUsage = `usage: shortener -keys-path FILE keys <command>
+
+commands:
+  mint OWNER   create an API key for OWNER and print it (shown only once)
+  revoke ID    revoke the key with ID
+  list         list keys (id, owner, created, revoked)`
+
+// runKeys is the admin command that manages the API keys file used by
+// the server. The server picks up changes without a restart.
+func runKeys(path string, args []string) error {
+	if path == "" {
+		return errors.New("-keys-path is required to manage API keys")
+	}
+	if len(args) == 0 {
+		return errors.New(keysUsage)
+	}
+
+	keys, err := api.OpenKeyStore(path)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "mint":
+		if len(args) != 2 {
+			return errors.New(keysUsage)
+		}
+		token, key, err := keys.Mint(args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("id:    %s\nowner: %s\nkey:   %s\n", key.ID, key.Owner, token)
+		fmt.Fprintln(os.Stderr, "Store the key now, it cannot be shown again.")
+		return nil
+
+	case "revoke":
+		if len(args) != 2 {
+			return errors.New(keysUsage)
+		}
+		if err := keys.Revoke(args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("revoked %s\n", args[1])
+		return nil
+
+	case "list":
+		list, err := keys.List()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tOWNER\tCREATED\tREVOKED")
+		for _, key := range list {
+			revoked := "-"
+			if key.RevokedAt != nil {
+				revoked = key.RevokedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", key.ID, key.Owner, key.CreatedAt.Format(time.RFC3339), revoked)
+		}
+		return w.Flush()
+
+	default:
+		return errors.New(keysUsage)
+	}
+}
+
+const linksUsage = `usage: shortener -store file -store-path FILE links <command>
+
+commands:
+  export [-format json|csv] [OUT]                 write every link, with its owner, to OUT (default stdout)
+  import [-format json|csv] [-on-conflict skip|overwrite] IN
+                                                  load a file written by export, keeping codes and owners
+
+Stop the server first: it does not see links written by another process.
+The format defaults to csv for files ending in .csv and json otherwise.`
+
+// runLinks is the admin command that moves every link between stores,
+// owners included. Unlike GET /api/export and POST /api/import, which only
+// see the links of the calling key, it works on the store directly.
+func runLinks(backend, path, baseURL string, checker api.URLChecker, args []string) error {
+	if backend == "memory" {
+		return errors.New("links needs a persistent store, use -store file")
+	}
+	if len(args) == 0 || (args[0] != "export" && args[0] != "import") {
+		return errors.New(linksUsage)
+	}
+
+	fs := flag.NewFlagSet("links "+args[0], flag.ContinueOnError)
+	format := fs.String("format", "", "json or csv")
+	onConflict := fs.String("on-conflict", "skip", "skip or overwrite codes already in the store")
+	if err := fs.Parse(args[1:]); err != nil || fs.NArg() > 1 {
+		return errors.New(linksUsage)
+	}
+	file := fs.Arg(0)
+	if *format == "" {
+		*format = "json"
+		if strings.EqualFold(filepath.Ext(file), ".csv") {
+			*format = "csv"
+		}
+	}
+	if *format != "json" && *format != "csv" {
+		return errors.New("-format must be json or csv")
+	}
+
+	store, err := openStore(backend, path)
+	if err != nil {
+		return err
+	}
+	if closer, ok := store.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	switch args[0] {
+	case "export":
+		links, err := store.List()
+		if err != nil {
+			return err
+		}
+		if file == "" || file == "-" {
+			return api.WriteLinks(os.Stdout, links, *format)
+		}
+		out, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		if err := api.WriteLinks(out, links, *format); err != nil {
+			out.Close()
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+		fmt.Printf("exported %d links to %s\n", len(links), file)
+		return nil
+
+	case "import":
+		if file == "" {
+			return errors.New(linksUsage)
+		}
+		if *onConflict != "skip" && *onConflict != "overwrite" {
+			return errors.New("-on-conflict must be skip or overwrite")
+		}
+		in := os.Stdin
+		if file != "-" {
+			if in, err = os.Open(file); err != nil {
+				return err
+			}
+			defer in.Close()
+		}
+		links, rowErrs, err := api.ReadLinks(in, *format == "csv")
+		if err != nil {
+			return fmt.Errorf("read %s: %w", file, err)
+		}
+		opts := api.ImportOptions{Overwrite: *onConflict == "overwrite", Checker: checker, RowErrs: rowErrs}
+		if u, err := url.Parse(baseURL); err == nil && u.Host != "" {
+			opts.SelfHosts = []string{u.Host}
+		}
+		result := api.ImportLinks(context.Background(), store, links, opts)
+		for _, e := range result.Errors {
+			fmt.Fprintf(os.Stderr, "link %d (%s): %s\n", e.Index, e.Code, e.Error)
+		}
+		fmt.Printf("imported %d, skipped %d, failed %d\n", result.Imported, result.Skipped, result.Failed)
+		return nil
+
+	default:
+		return errors.New(linksUsage)
+	}
+}
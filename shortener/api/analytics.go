@@ -0,0 +1,241 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultAnalyticsBuffer is how many hits can wait to be aggregated
+	// before new ones are dropped.
+	DefaultAnalyticsBuffer = 4096
+	// recentHitsPerLink bounds the raw hits kept for each code.
+	recentHitsPerLink = 50
+	// maxReferrersPerLink bounds the distinct referrer hosts kept for each
+	// code; hits from further hosts are counted under otherReferrers.
+	maxReferrersPerLink = 100
+	otherReferrers      = "other"
+	// maxVisitorsPerLink bounds the IP hashes kept for each code, so
+	// uniqueVisitors stops growing at this value.
+	maxVisitorsPerLink = 10000
+)
+
+// Hit is a single visit to a short link.
+type Hit struct {
+	Time time.Time `json:"time"`
+	// Referrer is only the host of the Referer header, without path or
+	// query, which may carry tokens or personal data.
+	Referrer  string `json:"referrer,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+	// IPHash is a salted hash of the client IP, so unique visitors can be
+	// counted without storing addresses.
+	IPHash string `json:"ipHash"`
+
+	code string
+}
+
+// DayCount is the number of hits on a UTC day (YYYY-MM-DD).
+type DayCount struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// LinkStats is the payload of GET /api/links/{code}/stats.
+type LinkStats struct {
+	Code           string         `json:"code"`
+	Total          int            `json:"total"`
+	UniqueVisitors int            `json:"uniqueVisitors"`
+	Daily          []DayCount     `json:"daily"`
+	Referrers      map[string]int `json:"referrers"`
+	Recent         []Hit          `json:"recent"`
+}
+
+type linkStats struct {
+	total     int
+	daily     map[string]int
+	referrers map[string]int
+	visitors  map[string]struct{}
+	recent    []Hit
+}
+
+// Analytics aggregates hits in the background. Record only does a
+// non-blocking channel send, so redirects never wait on bookkeeping.
+type Analytics struct {
+	hits    chan Hit
+	done    chan struct{}
+	salt    []byte
+	dropped atomic.Int64
+
+	// closeMu orders Record's send against Close closing hits: Record
+	// holds it for reading, Close for writing.
+	closeMu sync.RWMutex
+	closed  bool
+
+	mu    sync.RWMutex
+	links map[string]*linkStats
+}
+
+// NewAnalytics starts the aggregation goroutine. Call Close to stop it
+// after draining the hits already queued.
+func NewAnalytics(buffer int) *Analytics {
+	salt := make([]byte, 16)
+	rand.Read(salt)
+
+	a := &Analytics{
+		hits:  make(chan Hit, buffer),
+		done:  make(chan struct{}),
+		salt:  salt,
+		links: make(map[string]*linkStats),
+	}
+	go a.run()
+	return a
+}
+
+// Record queues a hit for code. If the buffer is full the hit is dropped;
+// after Close it is ignored, so requests still running when the server's
+// shutdown times out cannot panic.
+func (a *Analytics) Record(code string, r *http.Request) {
+	hit := Hit{
+		Time:      time.Now().UTC(),
+		Referrer:  referrerHost(r.Referer()),
+		UserAgent: r.UserAgent(),
+		IPHash:    a.hashIP(r.RemoteAddr),
+		code:      code,
+	}
+	a.closeMu.RLock()
+	defer a.closeMu.RUnlock()
+	if a.closed {
+		return
+	}
+	select {
+	case a.hits <- hit:
+	default:
+		if a.dropped.Add(1)%1000 == 1 {
+			slog.Warn("analytics buffer full, dropping hits", "dropped", a.dropped.Load())
+		}
+	}
+}
+
+// referrerHost reduces a Referer header to its host. Values without one,
+// like android-app:// or garbage, become otherReferrers.
+func referrerHost(referer string) string {
+	if referer == "" {
+		return ""
+	}
+	u, err := url.Parse(referer)
+	if err != nil || u.Hostname() == "" {
+		return otherReferrers
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+func (a *Analytics) hashIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	sum := sha256.Sum256(append(a.salt, host...))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (a *Analytics) run() {
+	defer close(a.done)
+	for hit := range a.hits {
+		a.add(hit)
+	}
+}
+
+func (a *Analytics) add(hit Hit) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s, ok := a.links[hit.code]
+	if !ok {
+		s = &linkStats{
+			daily:     make(map[string]int),
+			referrers: make(map[string]int),
+			visitors:  make(map[string]struct{}),
+		}
+		a.links[hit.code] = s
+	}
+	s.total++
+	s.daily[hit.Time.Format(time.DateOnly)]++
+	if hit.Referrer != "" {
+		if _, seen := s.referrers[hit.Referrer]; seen || len(s.referrers) < maxReferrersPerLink {
+			s.referrers[hit.Referrer]++
+		} else {
+			s.referrers[otherReferrers]++
+		}
+	}
+	if len(s.visitors) < maxVisitorsPerLink {
+		s.visitors[hit.IPHash] = struct{}{}
+	}
+	if len(s.recent) == recentHitsPerLink {
+		s.recent = s.recent[1:]
+	}
+	s.recent = append(s.recent, hit)
+}
+
+// Stats returns the aggregated numbers for code. Links never visited
+// return zero counts.
+func (a *Analytics) Stats(code string) LinkStats {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	stats := LinkStats{
+		Code:      code,
+		Daily:     []DayCount{},
+		Referrers: map[string]int{},
+		Recent:    []Hit{},
+	}
+	s, ok := a.links[code]
+	if !ok {
+		return stats
+	}
+
+	stats.Total = s.total
+	stats.UniqueVisitors = len(s.visitors)
+	for date, count := range s.daily {
+		stats.Daily = append(stats.Daily, DayCount{Date: date, Count: count})
+	}
+	sort.Slice(stats.Daily, func(i, j int) bool { return stats.Daily[i].Date < stats.Daily[j].Date })
+	for referrer, count := range s.referrers {
+		stats.Referrers[referrer] = count
+	}
+	stats.Recent = append(stats.Recent, s.recent...)
+	return stats
+}
+
+// Dropped returns how many hits were lost to a full buffer.
+func (a *Analytics) Dropped() int64 {
+	return a.dropped.Load()
+}
+
+// Forget drops the stats of a deleted link.
+func (a *Analytics) Forget(code string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.links, code)
+}
+
+// Close stops accepting hits and waits until the queued ones are aggregated.
+// Calling it again only waits.
+func (a *Analytics) Close() {
+	a.closeMu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.hits)
+	}
+	a.closeMu.Unlock()
+	<-a.done
+}
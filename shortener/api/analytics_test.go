@@ -0,0 +1,71 @@
+package api
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReferrerHost(t *testing.T) {
+	tests := map[string]string{
+		"":                                "",
+		"https://T.co/abc?token=secret":   "t.co",
+		"http://example.com:8080/a/b":     "example.com",
+		"android-app://com.example.app/x": "com.example.app",
+		"not a url\x7f":                   otherReferrers,
+		"/relative":                       otherReferrers,
+	}
+	for referer, want := range tests {
+		if got := referrerHost(referer); got != want {
+			t.Errorf("referrerHost(%q) = %q, want %q", referer, got, want)
+		}
+	}
+}
+
+func TestAnalyticsBoundsPerLink(t *testing.T) {
+	a := NewAnalytics(1)
+	defer a.Close()
+
+	for i := range maxReferrersPerLink + 50 {
+		a.add(Hit{code: "x", Time: time.Now(), Referrer: fmt.Sprintf("site%d.example", i), IPHash: fmt.Sprint(i)})
+	}
+	for i := range maxVisitorsPerLink {
+		a.add(Hit{code: "x", Time: time.Now(), IPHash: fmt.Sprint("v", i)})
+	}
+
+	stats := a.Stats("x")
+	if len(stats.Referrers) != maxReferrersPerLink+1 {
+		t.Errorf("%d referrers kept, want %d", len(stats.Referrers), maxReferrersPerLink+1)
+	}
+	if stats.Referrers[otherReferrers] != 50 {
+		t.Errorf("other referrers = %d, want 50", stats.Referrers[otherReferrers])
+	}
+	if stats.UniqueVisitors != maxVisitorsPerLink {
+		t.Errorf("unique visitors = %d, want %d", stats.UniqueVisitors, maxVisitorsPerLink)
+	}
+}
+
+func TestRecordKeepsOnlyReferrerHost(t *testing.T) {
+	a := NewAnalytics(1)
+	r := httptest.NewRequest("GET", "/x", nil)
+	r.Header.Set("Referer", "https://mail.example/inbox?session=abc")
+	a.Record("x", r)
+	a.Close()
+
+	if got := a.Stats("x").Recent[0].Referrer; got != "mail.example" {
+		t.Errorf("recorded referrer %q, want %q", got, "mail.example")
+	}
+}
+
+// Handlers still running after a timed-out shutdown may record hits once
+// Analytics is closed.
+func TestRecordAfterClose(t *testing.T) {
+	a := NewAnalytics(1)
+	a.Close()
+	a.Record("x", httptest.NewRequest("GET", "/x", nil))
+	a.Close()
+	if got := a.Stats("x").Total; got != 0 {
+		t.Errorf("total = %d after close, want 0", got)
+	}
+}
@@ -2,10 +2,12 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
-	"math/rand"
 	"net/http"
-	"net/url"
+	"net/netip"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -31,21 +33,127 @@ func sendJSON(w http.ResponseWriter, resp Response, status int) {
 	}
 }
 
-func NewHandler(db map[string]string) http.Handler {
+// Config holds the optional settings of the handler. The zero value is
+// ready to use.
+type Config struct {
+	// CodeGenerator creates short codes. Defaults to 8 random base62 characters.
+	CodeGenerator CodeGenerator
+	// Analytics records redirects. Defaults to a new Analytics that is
+	// never closed; pass your own to flush it on shutdown.
+	Analytics *Analytics
+	// Keys enables API key authentication on the /api routes. When nil
+	// the API is open and links have no owner.
+	Keys *KeyStore
+	// ShortenLimit and RedirectLimit rate limit POST /api/shorten and
+	// GET /{code} per API key owner or client IP. Zero disables them.
+	ShortenLimit  RateLimit
+	RedirectLimit RateLimit
+	// BulkLimit is counted in links: each item of POST /api/shorten/bulk
+	// takes a token, so its Burst is also the largest batch accepted.
+	// ImportLimit counts POST /api/import requests. Zero disables them.
+	BulkLimit   RateLimit
+	ImportLimit RateLimit
+	// Titles looks up the <title> of each new destination for the
+	// preview page (GET /{code}+). It makes an outgoing request per link.
+	// Nil disables it; close it after the server stops and before the
+	// store, so no fetch writes to a closed store.
+	Titles *TitleFetcher
+	// Safety vets destinations when links are created, changed or
+	// imported, failing closed. It may be slow or remote, like a
+	// WebhookChecker. Nil disables the checks.
+	Safety URLChecker
+	// RedirectSafety is consulted again on every redirect, so rules added
+	// later also stop old links. It sits on the hot path and must answer
+	// from local state, like a Blocklist; errors let the redirect through.
+	// Nil skips it.
+	RedirectSafety URLChecker
+	// BaseURL is the public address of the service, like "https://sho.rt",
+	// used to build the short URLs returned by the API. When empty they
+	// are built from the scheme and host of each request.
+	BaseURL string
+	// Metrics collects the numbers served on /metrics. Defaults to a new
+	// Metrics.
+	Metrics *Metrics
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For is
+	// believed. Without them every request behind a proxy shares the
+	// proxy's address, and so one rate limit bucket.
+	TrustedProxies []netip.Prefix
+	// Readiness is drained on shutdown to fail /readyz. Defaults to a new
+	// Readiness that is never drained.
+	Readiness *Readiness
+}
+
+func NewHandler(store Store, cfg Config) http.Handler {
+	if cfg.CodeGenerator == nil {
+		cfg.CodeGenerator, _ = NewRandomGenerator(DefaultCodeLength, DefaultAlphabet)
+	}
+	if cfg.Analytics == nil {
+		cfg.Analytics = NewAnalytics(DefaultAnalyticsBuffer)
+	}
+	if cfg.Metrics == nil {
+		cfg.Metrics = NewMetrics()
+	}
+	if cfg.Readiness == nil {
+		cfg.Readiness = &Readiness{}
+	}
+
+	titles := cfg.Titles
+	creator := linkCreator{store: store, gen: cfg.CodeGenerator, titles: titles, checker: cfg.Safety, baseURL: cfg.BaseURL, metrics: cfg.Metrics}
+
 	r := chi.NewMux()
 
+	if len(cfg.TrustedProxies) > 0 {
+		r.Use(realClientIP(cfg.TrustedProxies))
+	}
+	// Outside Recoverer, so panics are counted as the 500 it answers with.
+	r.Use(cfg.Metrics.middleware)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
 	r.Use(middleware.Logger)
 
-	r.Post("/api/shorten", handlePost(db))
-	r.Get("/{code}", handleGet(db))
+	r.Get("/healthz", handleHealthz)
+	r.Get("/readyz", handleReadyz(store, cfg.Readiness))
+	r.Get("/metrics", handleMetrics(cfg.Metrics, store, cfg.Analytics))
+
+	r.Group(func(r chi.Router) {
+		if cfg.Keys != nil {
+			r.Use(requireAPIKey(cfg.Keys))
+		}
+		r.With(rateLimit(cfg.ShortenLimit)).Post("/api/shorten", handlePost(creator))
+		r.Post("/api/shorten/bulk", handleBulk(creator, newItemLimiter(cfg.BulkLimit)))
+		r.Get("/api/export", handleExport(store))
+		r.With(rateLimit(cfg.ImportLimit)).Post("/api/import", handleImport(store, cfg.CodeGenerator, cfg.Safety, cfg.BaseURL))
+		r.Get("/api/links", handleList(store))
+		r.Get("/api/links/{code}", handleInspect(store))
+		r.Patch("/api/links/{code}", handlePatch(store, titles, cfg.Safety, cfg.BaseURL))
+		r.Delete("/api/links/{code}", handleDelete(store, cfg.Analytics))
+		r.Get("/api/links/{code}/stats", handleStats(store, cfg.Analytics))
+		r.Get("/api/links/{code}/qr", handleQR(store, cfg.BaseURL))
+	})
+	r.With(rateLimit(cfg.RedirectLimit)).Get("/{code}", handleGet(store, cfg.Analytics, cfg.RedirectSafety))
 
 	return r
 }
 
 type PostBody struct {
 	URL string `json:"url"`
+	// Alias is an optional vanity code, like "promo2026".
+	Alias string `json:"alias,omitempty"`
+	// ExpiresAt and TTL (a Go duration such as "72h") optionally limit
+	// how long the link works. Only one of them may be set.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	TTL       string     `json:"ttl,omitempty"`
+	// RedirectStatus optionally picks 301, 302, 307 or 308.
+	RedirectStatus int `json:"redirectStatus,omitempty"`
+	// ForwardQuery and UTM control the query string added on redirect.
+	ForwardQuery bool `json:"forwardQuery,omitempty"`
+	UTM          *UTM `json:"utm,omitempty"`
+}
+
+// ShortenResult is the payload of a successful POST /api/shorten.
+type ShortenResult struct {
+	Code     string `json:"code"`
+	ShortURL string `json:"shortUrl"`
 }
 
 type Response struct {
@@ -53,7 +161,78 @@ type Response struct {
 	Data  any    `json:"data,omitempty"`
 }
 
-func handlePost(db map[string]string) http.HandlerFunc {
+// linkCreator holds what creating a link needs, shared by the single and
+// bulk shorten endpoints.
+type linkCreator struct {
+	store   Store
+	gen     CodeGenerator
+	titles  *TitleFetcher
+	checker URLChecker
+	baseURL string
+	metrics *Metrics
+}
+
+// create validates body and stores a new link owned by the caller. On
+// failure it returns the HTTP status to answer with and an error whose
+// message is safe to show to the client.
+func (c linkCreator) create(r *http.Request, body PostBody) (string, int, error) {
+	target, err := normalizeURL(body.URL, serviceHosts(r, c.baseURL)...)
+	if err != nil {
+		return "", http.StatusBadRequest, err
+	}
+	if status, err := vetNewURL(r.Context(), c.checker, target); err != nil {
+		return "", status, err
+	}
+
+	if body.Alias != "" {
+		if err := validateAlias(body.Alias); err != nil {
+			return "", http.StatusBadRequest, err
+		}
+	}
+
+	if err := validateRedirectStatus(body.RedirectStatus); err != nil {
+		return "", http.StatusBadRequest, err
+	}
+
+	utm, err := normalizeUTM(body.UTM)
+	if err != nil {
+		return "", http.StatusBadRequest, err
+	}
+
+	now := time.Now()
+	expiresAt, err := expiryFromBody(body, now)
+	if err != nil {
+		return "", http.StatusBadRequest, err
+	}
+
+	link := Link{
+		URL:       target,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+		Owner:     ownerFromContext(r.Context()),
+
+		RedirectStatus: body.RedirectStatus,
+		ForwardQuery:   body.ForwardQuery,
+		UTM:            utm,
+	}
+	code, err := saveLink(c.store, c.gen, c.metrics, body.Alias, link)
+	if errors.Is(err, ErrCodeExists) {
+		return "", http.StatusConflict, errAliasTaken
+	}
+	if errors.Is(err, ErrCodeSpaceExhausted) {
+		slog.Error("failed to save link", "error", err)
+		return "", http.StatusServiceUnavailable, err
+	}
+	if err != nil {
+		slog.Error("failed to save link", "error", err)
+		return "", http.StatusInternalServerError, errors.New("something went wrong")
+	}
+	link.Code = code
+	c.titles.fetchAsync(c.store, link)
+	return code, http.StatusCreated, nil
+}
+
+func handlePost(creator linkCreator) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var body PostBody
 		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
@@ -65,44 +244,166 @@ func handlePost(db map[string]string) http.HandlerFunc {
 			return
 		}
 
-		if _, err := url.Parse(body.URL); err != nil {
+		code, status, err := creator.create(r, body)
+		if err != nil {
 			sendJSON(
 				w,
-				Response{Error: "invalid url passed"},
-				http.StatusBadRequest,
+				Response{Error: err.Error()},
+				status,
 			)
+			return
 		}
 
-		code := genCode()
-		db[code] = body.URL
-
 		sendJSON(
 			w,
-			Response{Data: code},
+			Response{Data: ShortenResult{Code: code, ShortURL: shortURL(creator.baseURL, r, code)}},
 			http.StatusCreated,
 		)
 	}
 }
 
-const characters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+// saveLink stores link under alias when one was requested, or under a
+// generated code otherwise.
+func saveLink(store Store, gen CodeGenerator, m *Metrics, alias string, link Link) (string, error) {
+	if alias != "" {
+		link.Code = alias
+		return alias, saveReplacingExpired(store, link)
+	}
+	return saveWithNewCode(store, gen, m, link)
+}
 
-func genCode() string {
-	const n = 8
-	byts := make([]byte, n)
-	for i := range n {
-		byts[i] = characters[rand.Intn(len(characters))]
+// saveReplacingExpired saves link, first removing an expired link that
+// still holds the code because the janitor has not purged it yet. The
+// expiry check and the removal happen under the store lock, so a link
+// renewed in between is never deleted.
+func saveReplacingExpired(store Store, link Link) error {
+	err := store.Save(link)
+	if !errors.Is(err, ErrCodeExists) {
+		return err
+	}
+	deleted, delErr := store.DeleteIfExpired(link.Code, time.Now())
+	if delErr != nil && !errors.Is(delErr, ErrNotFound) {
+		return delErr
 	}
-	return string(byts)
+	if !deleted && delErr == nil {
+		return err
+	}
+	// Removed here or, on ErrNotFound, by someone else in the meantime.
+	return store.Save(link)
 }
 
-func handleGet(db map[string]string) http.HandlerFunc {
+// saveWithNewCode stores link under a fresh code, retrying with a new
+// candidate whenever the store reports the code as taken. For deterministic
+// generators a collision with an identical link returns the existing code.
+func saveWithNewCode(store Store, gen CodeGenerator, m *Metrics, link Link) (string, error) {
+	_, deterministic := gen.(interface{ deterministic() bool })
+	_, link.Sequential = gen.(*SequentialGenerator)
+	for attempt := range maxCodeAttempts {
+		code, err := gen.Generate(link.URL, attempt)
+		if err != nil {
+			return "", err
+		}
+
+		link.Code = code
+		err = saveReplacingExpired(store, link)
+		if err == nil {
+			return code, nil
+		}
+		if !errors.Is(err, ErrCodeExists) {
+			return "", err
+		}
+
+		if deterministic {
+			if existing, err := store.Get(code); err == nil && sameTarget(existing, link) {
+				return code, nil
+			}
+		}
+		m.codeCollision()
+		slog.Warn("short code collision, retrying", "code", code, "attempt", attempt)
+	}
+	return "", ErrCodeSpaceExhausted
+}
+
+func handleGet(store Store, analytics *Analytics, checker URLChecker) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		code := chi.URLParam(r, "code")
-		data, ok := db[code]
-		if !ok {
+		code, preview := strings.CutSuffix(chi.URLParam(r, "code"), previewSuffix)
+		link, err := store.Get(code)
+		if errors.Is(err, ErrNotFound) {
 			http.Error(w, "url nao encontrada", http.StatusNotFound)
 			return
 		}
-		http.Redirect(w, r, data, http.StatusPermanentRedirect)
+		if err != nil {
+			slog.Error("failed to get link", "error", err)
+			http.Error(w, "something went wrong", http.StatusInternalServerError)
+			return
+		}
+		now := time.Now()
+		if link.Expired(now) {
+			http.Error(w, "link expirado", http.StatusGone)
+			return
+		}
+		if link.Disabled {
+			msg := "link desativado"
+			if link.DisabledReason != "" {
+				msg += ": " + link.DisabledReason
+			}
+			http.Error(w, msg, http.StatusUnavailableForLegalReasons)
+			return
+		}
+		if reason := blockedReason(r, checker, link); reason != "" {
+			slog.Warn("redirect blocked by safety check", "code", code, "reason", reason)
+			http.Error(w, "destino bloqueado: "+reason, http.StatusForbidden)
+			return
+		}
+		if preview {
+			servePreview(w, link)
+			return
+		}
+		analytics.Record(code, r)
+		setRedirectCacheHeaders(w, link, now)
+		http.Redirect(w, r, redirectTarget(link, r), link.redirectStatus())
+	}
+}
+
+// sameTarget reports whether two links behave the same apart from their
+// code and creation time.
+func sameTarget(a, b Link) bool {
+	if a.URL != b.URL || a.Owner != b.Owner || a.RedirectStatus != b.RedirectStatus || a.ForwardQuery != b.ForwardQuery {
+		return false
+	}
+	if (a.UTM == nil) != (b.UTM == nil) || (a.UTM != nil && *a.UTM != *b.UTM) {
+		return false
+	}
+	if (a.ExpiresAt == nil) != (b.ExpiresAt == nil) {
+		return false
+	}
+	return a.ExpiresAt == nil || a.ExpiresAt.Equal(*b.ExpiresAt)
+}
+
+var (
+	errExpiryBoth = errors.New("use either expiresAt or ttl, not both")
+	errExpiryTTL  = errors.New("ttl must be a positive duration, like \"24h\" or \"90m\"")
+	errExpiryPast = errors.New("expiresAt must be in the future")
+)
+
+// expiryFromBody resolves PostBody.ExpiresAt / PostBody.TTL into an
+// absolute expiration time, or nil when the link never expires.
+func expiryFromBody(body PostBody, now time.Time) (*time.Time, error) {
+	switch {
+	case body.ExpiresAt != nil && body.TTL != "":
+		return nil, errExpiryBoth
+	case body.TTL != "":
+		ttl, err := time.ParseDuration(body.TTL)
+		if err != nil || ttl <= 0 {
+			return nil, errExpiryTTL
+		}
+		expiresAt := now.Add(ttl)
+		return &expiresAt, nil
+	case body.ExpiresAt != nil:
+		if !body.ExpiresAt.After(now) {
+			return nil, errExpiryPast
+		}
+		return body.ExpiresAt, nil
 	}
+	return nil, nil
 }
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// do sends a request to h and returns the recorded response.
+func do(h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	return doRequest(h, httptest.NewRequest(method, target, strings.NewReader(body)))
+}
+
+func doRequest(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// decodeData unmarshals the "data" field of a JSON envelope into v.
+func decodeData(t *testing.T, w *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), &struct{ Data any }{v}); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+}
+
+func TestHandlePostCreatesLink(t *testing.T) {
+	store := NewMemoryStore()
+	h := NewHandler(store, Config{})
+
+	w := do(h, http.MethodPost, "/api/shorten", `{"url": "https://dest.example/a"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+	var result ShortenResult
+	decodeData(t, w, &result)
+	if result.ShortURL != "http://example.com/"+result.Code {
+		t.Errorf("shortUrl = %q for code %q", result.ShortURL, result.Code)
+	}
+	if link, err := store.Get(result.Code); err != nil || link.URL != "https://dest.example/a" {
+		t.Errorf("stored link = %+v, %v", link, err)
+	}
+}
+
+func TestHandlePostExpiry(t *testing.T) {
+	store := NewMemoryStore()
+	h := NewHandler(store, Config{})
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		name, body string
+		status     int
+		err        error
+	}{
+		{"ttl", `{"url": "https://dest.example", "ttl": "90m"}`, http.StatusCreated, nil},
+		{"expiresAt", `{"url": "https://dest.example", "expiresAt": "` + future + `"}`, http.StatusCreated, nil},
+		{"both", `{"url": "https://dest.example", "ttl": "1h", "expiresAt": "` + future + `"}`, http.StatusBadRequest, errExpiryBoth},
+		{"past", `{"url": "https://dest.example", "expiresAt": "` + past + `"}`, http.StatusBadRequest, errExpiryPast},
+		{"bad ttl", `{"url": "https://dest.example", "ttl": "tomorrow"}`, http.StatusBadRequest, errExpiryTTL},
+		{"negative ttl", `{"url": "https://dest.example", "ttl": "-1h"}`, http.StatusBadRequest, errExpiryTTL},
+		{"zero ttl", `{"url": "https://dest.example", "ttl": "0s"}`, http.StatusBadRequest, errExpiryTTL},
+	}
+	for _, tt := range tests {
+		w := do(h, http.MethodPost, "/api/shorten", tt.body)
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.status, w.Body)
+			continue
+		}
+		if tt.err != nil {
+			var resp Response
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if resp.Error != tt.err.Error() {
+				t.Errorf("%s: error %q, want %q", tt.name, resp.Error, tt.err)
+			}
+			continue
+		}
+		var result ShortenResult
+		decodeData(t, w, &result)
+		if link, _ := store.Get(result.Code); link.ExpiresAt == nil || !link.ExpiresAt.After(time.Now()) {
+			t.Errorf("%s: stored expiresAt = %v", tt.name, link.ExpiresAt)
+		}
+	}
+}
+
+func TestHandleGetExpired(t *testing.T) {
+	past, future := time.Now().Add(-time.Second), time.Now().Add(time.Hour)
+	store := NewMemoryStore()
+	store.Save(Link{Code: "old", URL: "https://dest.example/", ExpiresAt: &past})
+	store.Save(Link{Code: "new", URL: "https://dest.example/", ExpiresAt: &future})
+	h := NewHandler(store, Config{})
+
+	for code, want := range map[string]int{"old": http.StatusGone, "new": http.StatusFound, "missing": http.StatusNotFound} {
+		if w := do(h, http.MethodGet, "/"+code, ""); w.Code != want {
+			t.Errorf("GET /%s: status %d, want %d", code, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// keyPrefix makes tokens easy to spot in logs and secret scanners.
+	keyPrefix   = "shk_"
+	keyIDLength = 8 // hex characters, part of the token and shown by "keys list"
+	// keyReloadInterval is how often the key file is checked for changes
+	// made by the admin command while the server is running.
+	keyReloadInterval = time.Second
+)
+
+var (
+	ErrKeyNotFound = errors.New("api key not found")
+	errNoAPIKey    = errors.New("missing api key")
+	errBadAPIKey   = errors.New("invalid api key")
+	errNotOwner    = errors.New("link belongs to another owner")
+)
+
+// APIKey is a credential as stored on disk. Only the SHA-256 of the token
+// is kept, so the file cannot be used to call the API.
+type APIKey struct {
+	ID        string     `json:"id"`
+	Owner     string     `json:"owner"`
+	Hash      string     `json:"hash"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// KeyStore keeps API keys in a JSON file. The server and the admin command
+// share the file: writes replace it atomically and the server reloads it
+// when its modification time changes.
+type KeyStore struct {
+	mu        sync.Mutex
+	path      string
+	keys      []APIKey
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// OpenKeyStore loads the keys in path. A missing file is an empty store.
+func OpenKeyStore(path string) (*KeyStore, error) {
+	k := &KeyStore{path: path}
+	if err := k.load(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (k *KeyStore) load() error {
+	info, err := os.Stat(k.path)
+	if errors.Is(err, os.ErrNotExist) {
+		k.keys, k.modTime = nil, time.Time{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("stat key file: %w", err)
+	}
+
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return fmt.Errorf("read key file: %w", err)
+	}
+	var keys []APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("parse key file: %w", err)
+	}
+	k.keys, k.modTime = keys, info.ModTime()
+	return nil
+}
+
+// reloadIfChanged picks up keys minted or revoked by another process.
+// Callers must hold k.mu.
+func (k *KeyStore) reloadIfChanged(now time.Time) error {
+	if now.Sub(k.checkedAt) < keyReloadInterval {
+		return nil
+	}
+	k.checkedAt = now
+
+	info, err := os.Stat(k.path)
+	if errors.Is(err, os.ErrNotExist) && len(k.keys) == 0 {
+		return nil
+	}
+	if err == nil && info.ModTime().Equal(k.modTime) {
+		return nil
+	}
+	return k.load()
+}
+
+// save writes the keys to a temp file and renames it over the key file.
+// Callers must hold k.mu.
+func (k *KeyStore) save() error {
+	data, err := json.MarshalIndent(k.keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(k.path), filepath.Base(k.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create key file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write key file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync key file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), k.path); err != nil {
+		return fmt.Errorf("replace key file: %w", err)
+	}
+
+	if info, err := os.Stat(k.path); err == nil {
+		k.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// Mint creates a key for owner and returns the token. The token is only
+// available here; afterwards just its hash is stored.
+func (k *KeyStore) Mint(owner string) (string, APIKey, error) {
+	owner = strings.TrimSpace(owner)
+	if owner == "" {
+		return "", APIKey{}, errors.New("owner is required")
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", APIKey{}, err
+	}
+	id := make([]byte, keyIDLength/2)
+	if _, err := rand.Read(id); err != nil {
+		return "", APIKey{}, err
+	}
+	token := keyPrefix + hex.EncodeToString(id) + hex.EncodeToString(secret)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.load(); err != nil {
+		return "", APIKey{}, err
+	}
+	key := APIKey{
+		ID:        hex.EncodeToString(id),
+		Owner:     owner,
+		Hash:      hashToken(token),
+		CreatedAt: time.Now().UTC(),
+	}
+	k.keys = append(k.keys, key)
+	if err := k.save(); err != nil {
+		return "", APIKey{}, err
+	}
+	return token, key, nil
+}
+
+// Revoke disables the key with id. Revoking twice is not an error.
+func (k *KeyStore) Revoke(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.load(); err != nil {
+		return err
+	}
+	for i := range k.keys {
+		if k.keys[i].ID != id {
+			continue
+		}
+		if k.keys[i].RevokedAt == nil {
+			now := time.Now().UTC()
+			k.keys[i].RevokedAt = &now
+		}
+		return k.save()
+	}
+	return ErrKeyNotFound
+}
+
+// List returns every key, revoked ones included.
+func (k *KeyStore) List() ([]APIKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.load(); err != nil {
+		return nil, err
+	}
+	return append([]APIKey(nil), k.keys...), nil
+}
+
+// Authenticate returns the owner of token if it is a known, active key.
+func (k *KeyStore) Authenticate(token string) (string, bool) {
+	if !strings.HasPrefix(token, keyPrefix) || len(token) < len(keyPrefix)+keyIDLength {
+		return "", false
+	}
+	id := token[len(keyPrefix) : len(keyPrefix)+keyIDLength]
+	hash := hashToken(token)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.reloadIfChanged(time.Now()); err != nil {
+		slog.Error("failed to reload api keys, keeping the previous ones", "error", err)
+	}
+	for _, key := range k.keys {
+		if key.ID == id && key.RevokedAt == nil &&
+			subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hash)) == 1 {
+			return key.Owner, true
+		}
+	}
+	return "", false
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type ownerKey struct{}
+
+// ownerFromContext returns the owner set by requireAPIKey. Without
+// authentication every request has the empty owner.
+func ownerFromContext(ctx context.Context) string {
+	owner, _ := ctx.Value(ownerKey{}).(string)
+	return owner
+}
+
+// apiKeyFromRequest accepts "Authorization: Bearer <key>" or "X-API-Key: <key>".
+func apiKeyFromRequest(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+// requireAPIKey rejects requests without a valid key and stores the key
+// owner in the request context.
+func requireAPIKey(keys *KeyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := apiKeyFromRequest(r)
+			if token == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="shortener"`)
+				sendJSON(w, Response{Error: errNoAPIKey.Error()}, http.StatusUnauthorized)
+				return
+			}
+			owner, ok := keys.Authenticate(token)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="shortener", error="invalid_token"`)
+				sendJSON(w, Response{Error: errBadAPIKey.Error()}, http.StatusUnauthorized)
+				return
+			}
+			ctx := context.WithValue(r.Context(), ownerKey{}, owner)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
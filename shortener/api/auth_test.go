@@ -0,0 +1,123 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// authRequest sends a request with token as the API key, if set.
+func authRequest(h http.Handler, method, target, token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return doRequest(h, r)
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	keys, err := OpenKeyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, key, err := keys.Mint("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(NewMemoryStore(), Config{Keys: keys})
+	wrongSecret := token[:len(token)-1] + "0"
+	if wrongSecret == token {
+		wrongSecret = token[:len(token)-1] + "1"
+	}
+
+	tests := []struct {
+		name, token string
+		want        int
+	}{
+		{"missing key", "", http.StatusUnauthorized},
+		{"invalid key", "shk_0000000000000000", http.StatusUnauthorized},
+		{"wrong secret", wrongSecret, http.StatusUnauthorized},
+		{"valid key", token, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := authRequest(h, http.MethodGet, "/api/links", tt.token, ""); w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+	r := httptest.NewRequest(http.MethodGet, "/api/links", nil)
+	r.Header.Set("X-API-Key", token)
+	if w := doRequest(h, r); w.Code != http.StatusOK {
+		t.Errorf("X-API-Key: status %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// Revoked by the admin command, a separate process with its own KeyStore.
+	admin, err := OpenKeyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.Revoke(key.ID); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+	keys.mu.Lock()
+	keys.checkedAt = time.Time{}
+	keys.mu.Unlock()
+	if w := authRequest(h, http.MethodGet, "/api/links", token, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked key: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestLinksScopedToOwner(t *testing.T) {
+	keys, err := OpenKeyStore(filepath.Join(t.TempDir(), "keys.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, _, _ := keys.Mint("alice")
+	bob, _, _ := keys.Mint("bob")
+	store := NewMemoryStore()
+	store.Save(Link{Code: "alice1", URL: "https://a.example/", Owner: "alice"})
+	store.Save(Link{Code: "alice2", URL: "https://a.example/2", Owner: "alice"})
+	store.Save(Link{Code: "bob1", URL: "https://b.example/", Owner: "bob"})
+	h := NewHandler(store, Config{Keys: keys})
+
+	routes := []struct {
+		method, target, body string
+		own                  int
+	}{
+		{http.MethodGet, "/api/links/bob1", "", http.StatusOK},
+		{http.MethodPatch, "/api/links/bob1", `{"forwardQuery": true}`, http.StatusOK},
+		{http.MethodGet, "/api/links/bob1/stats", "", http.StatusOK},
+		{http.MethodGet, "/api/links/bob1/qr", "", http.StatusOK},
+		{http.MethodDelete, "/api/links/bob1", "", http.StatusOK},
+	}
+	for _, rt := range routes {
+		if w := authRequest(h, rt.method, rt.target, alice, rt.body); w.Code != http.StatusForbidden {
+			t.Errorf("alice %s %s: status %d, want %d", rt.method, rt.target, w.Code, http.StatusForbidden)
+		}
+	}
+	if link, err := store.Get("bob1"); err != nil || link.ForwardQuery {
+		t.Errorf("bob1 changed by another owner: %+v, %v", link, err)
+	}
+	for _, rt := range routes {
+		if w := authRequest(h, rt.method, rt.target, bob, rt.body); w.Code != rt.own {
+			t.Errorf("bob %s %s: status %d, want %d", rt.method, rt.target, w.Code, rt.own)
+		}
+	}
+
+	for _, target := range []string{"/api/links", "/api/export"} {
+		w := authRequest(h, http.MethodGet, target, alice, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d", target, w.Code)
+		}
+		body := w.Body.String()
+		if !strings.Contains(body, "alice1") || !strings.Contains(body, "alice2") || strings.Contains(body, "bob1") {
+			t.Errorf("GET %s for alice = %s", target, body)
+		}
+	}
+}
@@ -0,0 +1,525 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxBulkItems caps POST /api/shorten/bulk. Each item also takes a
+	// token from Config.BulkLimit.
+	maxBulkItems  = 1000
+	maxBulkBody   = 1 << 20
+	maxImportBody = 32 << 20
+)
+
+var (
+	errBulkEmpty    = errors.New("no urls given")
+	errBulkTooMany  = fmt.Errorf("at most %d urls per request", maxBulkItems)
+	errBulkItem     = errors.New("each item must be a url string or an object like {\"url\": \"...\"}")
+	errCSVNoURL     = errors.New("csv needs a url column")
+	errCodeInvalid  = fmt.Errorf("code must have between 1 and %d letters, digits, '-' or '_'", maxAliasLength)
+	errConflictMode = errors.New("onConflict must be skip or overwrite")
+)
+
+// BulkResult is the outcome of one item of a bulk request, in input order.
+type BulkResult struct {
+	URL      string `json:"url"`
+	Code     string `json:"code,omitempty"`
+	ShortURL string `json:"shortUrl,omitempty"`
+	Status   int    `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// BulkResponse is the payload of POST /api/shorten/bulk.
+type BulkResponse struct {
+	Created int          `json:"created"`
+	Failed  int          `json:"failed"`
+	Results []BulkResult `json:"results"`
+}
+
+// bulkColumns is the column order of a CSV without a header row.
+var bulkColumns = []string{"url", "alias", "ttl"}
+
+// exportColumns is the CSV layout of GET /api/export and POST /api/import.
+var exportColumns = []string{"code", "url", "createdAt", "expiresAt", "redirectStatus", "title", "disabled", "disabledReason",
+	"forwardQuery", "utmSource", "utmMedium", "utmCampaign", "utmTerm", "utmContent", "sequential", "owner"}
+
+// isCSV reports whether the request body is declared as text/csv.
+func isCSV(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "text/csv"
+}
+
+// readCSV returns one map per row, keyed by column name. A first row with
+// a "url" cell is taken as the header; otherwise columns are positional.
+func readCSV(body io.Reader, columns []string) ([]map[string]string, error) {
+	cr := csv.NewReader(body)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	for _, cell := range records[0] {
+		if strings.EqualFold(strings.TrimSpace(cell), "url") {
+			columns = make([]string, len(records[0]))
+			for i, name := range records[0] {
+				columns[i] = strings.TrimSpace(name)
+			}
+			records = records[1:]
+			break
+		}
+	}
+	if !containsFold(columns, "url") {
+		return nil, errCSVNoURL
+	}
+
+	rows := make([]map[string]string, 0, len(records))
+	for _, record := range records {
+		row := make(map[string]string, len(columns))
+		for i, cell := range record {
+			if i < len(columns) {
+				row[strings.ToLower(columns[i])] = strings.TrimSpace(cell)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// bulkBodies reads the items of a bulk request: a JSON array of URL
+// strings and/or PostBody objects, or a CSV with url, alias and ttl columns.
+func bulkBodies(r *http.Request) ([]PostBody, error) {
+	if isCSV(r) {
+		rows, err := readCSV(r.Body, bulkColumns)
+		if err != nil {
+			return nil, err
+		}
+		bodies := make([]PostBody, 0, len(rows))
+		for i, row := range rows {
+			body := PostBody{URL: row["url"], Alias: row["alias"], TTL: row["ttl"]}
+			if raw := row["redirectstatus"]; raw != "" {
+				if body.RedirectStatus, err = strconv.Atoi(raw); err != nil {
+					return nil, fmt.Errorf("row %d: %w", i+1, errRedirectStatus)
+				}
+			}
+			bodies = append(bodies, body)
+		}
+		return bodies, nil
+	}
+
+	var items []json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+		return nil, err
+	}
+	bodies := make([]PostBody, 0, len(items))
+	for _, item := range items {
+		var body PostBody
+		if err := json.Unmarshal(item, &body.URL); err != nil {
+			if err := json.Unmarshal(item, &body); err != nil {
+				return nil, errBulkItem
+			}
+		}
+		bodies = append(bodies, body)
+	}
+	return bodies, nil
+}
+
+// handleBulk creates many links in one request. Items succeed or fail
+// independently; the response lists each outcome in input order.
+func handleBulk(creator linkCreator, limiter *itemLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBulkBody)
+		bodies, err := bulkBodies(r)
+		if err != nil {
+			sendJSON(w, Response{Error: "invalid body: " + err.Error()}, http.StatusUnprocessableEntity)
+			return
+		}
+		if len(bodies) == 0 {
+			sendJSON(w, Response{Error: errBulkEmpty.Error()}, http.StatusBadRequest)
+			return
+		}
+		if len(bodies) > maxBulkItems {
+			sendJSON(w, Response{Error: errBulkTooMany.Error()}, http.StatusRequestEntityTooLarge)
+			return
+		}
+		if !limiter.take(w, r, len(bodies)) {
+			return
+		}
+
+		resp := BulkResponse{Results: make([]BulkResult, 0, len(bodies))}
+		for _, body := range bodies {
+			result := BulkResult{URL: body.URL}
+			code, status, err := creator.create(r, body)
+			result.Status = status
+			if err != nil {
+				result.Error = err.Error()
+				resp.Failed++
+			} else {
+				result.Code = code
+				result.ShortURL = shortURL(creator.baseURL, r, code)
+				resp.Created++
+			}
+			resp.Results = append(resp.Results, result)
+		}
+		sendJSON(w, Response{Data: resp}, http.StatusOK)
+	}
+}
+
+// handleExport downloads the caller's links as a JSON array (the default)
+// or as CSV with ?format=csv. Both can be fed back to POST /api/import.
+func handleExport(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := strings.ToLower(r.URL.Query().Get("format"))
+		if format == "" {
+			format = "json"
+		}
+		if format != "json" && format != "csv" {
+			sendJSON(w, Response{Error: "format must be json or csv"}, http.StatusBadRequest)
+			return
+		}
+
+		links, err := ownedLinks(r, store)
+		if err != nil {
+			sendStoreError(w, err)
+			return
+		}
+
+		filename := "links-" + time.Now().UTC().Format("20060102-150405") + "." + format
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		if format == "json" {
+			w.Header().Set("Content-Type", "application/json")
+		} else {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		}
+		if err := WriteLinks(w, links, format); err != nil {
+			slog.Error("failed to write export", "error", err)
+		}
+	}
+}
+
+// WriteLinks writes links in the export format: "json" for an indented
+// JSON array, "csv" for exportColumns with a header row.
+func WriteLinks(w io.Writer, links []Link, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(links)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(exportColumns)
+		for _, link := range links {
+			cw.Write(linkRecord(link))
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// linkRecord lays link out as exportColumns.
+func linkRecord(link Link) []string {
+	expiresAt := ""
+	if link.ExpiresAt != nil {
+		expiresAt = link.ExpiresAt.Format(time.RFC3339Nano)
+	}
+	redirectStatus := ""
+	if link.RedirectStatus != 0 {
+		redirectStatus = strconv.Itoa(link.RedirectStatus)
+	}
+	var utm UTM
+	if link.UTM != nil {
+		utm = *link.UTM
+	}
+	return []string{
+		link.Code,
+		link.URL,
+		link.CreatedAt.Format(time.RFC3339Nano),
+		expiresAt,
+		redirectStatus,
+		link.Title,
+		strconv.FormatBool(link.Disabled),
+		link.DisabledReason,
+		strconv.FormatBool(link.ForwardQuery),
+		utm.Source,
+		utm.Medium,
+		utm.Campaign,
+		utm.Term,
+		utm.Content,
+		strconv.FormatBool(link.Sequential),
+		link.Owner,
+	}
+}
+
+// linkFromRow parses a CSV row written by linkRecord.
+func linkFromRow(row map[string]string) (Link, error) {
+	link := Link{
+		Code:           row["code"],
+		URL:            row["url"],
+		Title:          row["title"],
+		DisabledReason: row["disabledreason"],
+		Owner:          row["owner"],
+		UTM: &UTM{
+			Source:   row["utmsource"],
+			Medium:   row["utmmedium"],
+			Campaign: row["utmcampaign"],
+			Term:     row["utmterm"],
+			Content:  row["utmcontent"],
+		},
+	}
+	var err error
+	if raw := row["createdat"]; raw != "" {
+		if link.CreatedAt, err = time.Parse(time.RFC3339Nano, raw); err != nil {
+			return Link{}, fmt.Errorf("invalid createdAt: %w", err)
+		}
+	}
+	if raw := row["expiresat"]; raw != "" {
+		expiresAt, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			return Link{}, fmt.Errorf("invalid expiresAt: %w", err)
+		}
+		link.ExpiresAt = &expiresAt
+	}
+	if raw := row["redirectstatus"]; raw != "" {
+		if link.RedirectStatus, err = strconv.Atoi(raw); err != nil {
+			return Link{}, errRedirectStatus
+		}
+	}
+	if raw := row["disabled"]; raw != "" {
+		if link.Disabled, err = strconv.ParseBool(raw); err != nil {
+			return Link{}, fmt.Errorf("invalid disabled: %w", err)
+		}
+	}
+	if raw := row["forwardquery"]; raw != "" {
+		if link.ForwardQuery, err = strconv.ParseBool(raw); err != nil {
+			return Link{}, fmt.Errorf("invalid forwardQuery: %w", err)
+		}
+	}
+	if raw := row["sequential"]; raw != "" {
+		if link.Sequential, err = strconv.ParseBool(raw); err != nil {
+			return Link{}, fmt.Errorf("invalid sequential: %w", err)
+		}
+	}
+	return link, nil
+}
+
+// ImportError describes a link that could not be imported. Index is the
+// position of the link in the uploaded file, starting at 0.
+type ImportError struct {
+	Index int    `json:"index"`
+	Code  string `json:"code,omitempty"`
+	Error string `json:"error"`
+}
+
+// ImportResult is the payload of POST /api/import.
+type ImportResult struct {
+	Imported int           `json:"imported"`
+	Skipped  int           `json:"skipped"`
+	Failed   int           `json:"failed"`
+	Errors   []ImportError `json:"errors"`
+}
+
+// validateImportedCode is looser than validateAlias: generated codes may
+// be shorter than minAliasLength.
+func validateImportedCode(code string) error {
+	if code == "" || len(code) > maxAliasLength {
+		return errCodeInvalid
+	}
+	for i := 0; i < len(code); i++ {
+		if !isCodeChar(code[i]) {
+			return errCodeInvalid
+		}
+	}
+	if reservedAliases[strings.ToLower(code)] {
+		return errAliasReserved
+	}
+	return nil
+}
+
+// ReadLinks reads links in the export format: a JSON array, or CSV in the
+// exportColumns layout when csv is set. CSV rows that cannot be parsed are
+// reported in rowErrs by index, so the rest can still be imported.
+func ReadLinks(body io.Reader, csv bool) (links []Link, rowErrs map[int]error, err error) {
+	if !csv {
+		err = json.NewDecoder(body).Decode(&links)
+		return links, nil, err
+	}
+
+	rows, err := readCSV(body, exportColumns)
+	if err != nil {
+		return nil, nil, err
+	}
+	links = make([]Link, len(rows))
+	rowErrs = make(map[int]error)
+	for i, row := range rows {
+		link, err := linkFromRow(row)
+		if err != nil {
+			link = Link{Code: row["code"]}
+			rowErrs[i] = err
+		}
+		links[i] = link
+	}
+	return links, rowErrs, nil
+}
+
+// ImportOptions controls ImportLinks.
+type ImportOptions struct {
+	// Overwrite replaces links already stored under an imported code
+	// instead of skipping them.
+	Overwrite bool
+	// Checker vets each destination, like Config.Safety. Optional.
+	Checker URLChecker
+	// SelfHosts are the hosts of the service itself; destinations
+	// pointing at them are rejected.
+	SelfHosts []string
+	// RowErrs are the parse errors returned by ReadLinks.
+	RowErrs map[int]error
+
+	// owner, when set by POST /api/import, becomes the owner of every
+	// imported link, and only links it owns may be overwritten.
+	owner    *string
+	observer interface{ observe(code string) }
+}
+
+// ImportLinks saves links exported by another instance, keeping their
+// codes and, unless imported through the API, their owners. Expired links
+// and codes already in use are skipped; see ImportOptions.Overwrite.
+func ImportLinks(ctx context.Context, store Store, links []Link, opts ImportOptions) ImportResult {
+	result := ImportResult{Errors: []ImportError{}}
+	fail := func(i int, code string, err error) {
+		result.Failed++
+		result.Errors = append(result.Errors, ImportError{Index: i, Code: code, Error: err.Error()})
+	}
+
+	now := time.Now()
+	for i, link := range links {
+		if err := opts.RowErrs[i]; err != nil {
+			fail(i, link.Code, err)
+			continue
+		}
+		if err := validateImportedCode(link.Code); err != nil {
+			fail(i, link.Code, err)
+			continue
+		}
+		target, err := normalizeURL(link.URL, opts.SelfHosts...)
+		if err != nil {
+			fail(i, link.Code, err)
+			continue
+		}
+		if _, err := vetNewURL(ctx, opts.Checker, target); err != nil {
+			fail(i, link.Code, err)
+			continue
+		}
+		if err := validateRedirectStatus(link.RedirectStatus); err != nil {
+			fail(i, link.Code, err)
+			continue
+		}
+		if link.UTM, err = normalizeUTM(link.UTM); err != nil {
+			fail(i, link.Code, err)
+			continue
+		}
+		if link.Expired(now) {
+			result.Skipped++
+			continue
+		}
+		link.URL = target
+		if opts.owner != nil {
+			link.Owner = *opts.owner
+		}
+		if link.CreatedAt.IsZero() {
+			link.CreatedAt = now
+		}
+
+		err = saveReplacingExpired(store, link)
+		if errors.Is(err, ErrCodeExists) {
+			if !opts.Overwrite {
+				result.Skipped++
+				continue
+			}
+			_, err = store.Modify(link.Code, func(existing Link) (Link, error) {
+				if opts.owner != nil && existing.Owner != *opts.owner {
+					return existing, errNotOwner
+				}
+				return link, nil
+			})
+		}
+		if errors.Is(err, errNotOwner) {
+			fail(i, link.Code, err)
+			continue
+		}
+		if err != nil {
+			slog.Error("failed to import link", "code", link.Code, "error", err)
+			fail(i, link.Code, errors.New("something went wrong"))
+			continue
+		}
+		if link.Sequential && opts.observer != nil {
+			opts.observer.observe(link.Code)
+		}
+		result.Imported++
+	}
+	return result
+}
+
+// handleImport loads links exported by another instance, keeping their
+// codes. Imported links belong to the caller. Codes already in use are
+// skipped, or replaced with ?onConflict=overwrite when the caller owns
+// them; expired links are skipped. Imported sequential codes move gen past
+// them, so it does not hand them out again.
+func handleImport(store Store, gen CodeGenerator, checker URLChecker, baseURL string) http.HandlerFunc {
+	observer, _ := gen.(interface{ observe(code string) })
+	return func(w http.ResponseWriter, r *http.Request) {
+		overwrite := false
+		switch r.URL.Query().Get("onConflict") {
+		case "", "skip":
+		case "overwrite":
+			overwrite = true
+		default:
+			sendJSON(w, Response{Error: errConflictMode.Error()}, http.StatusBadRequest)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportBody)
+		links, rowErrs, err := ReadLinks(r.Body, isCSV(r))
+		if err != nil {
+			sendJSON(w, Response{Error: "invalid body: " + err.Error()}, http.StatusUnprocessableEntity)
+			return
+		}
+
+		owner := ownerFromContext(r.Context())
+		result := ImportLinks(r.Context(), store, links, ImportOptions{
+			Overwrite: overwrite,
+			Checker:   checker,
+			SelfHosts: serviceHosts(r, baseURL),
+			RowErrs:   rowErrs,
+			owner:     &owner,
+			observer:  observer,
+		})
+		sendJSON(w, Response{Data: result}, http.StatusOK)
+	}
+}
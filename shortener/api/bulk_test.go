@@ -0,0 +1,93 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Imported sequential codes must not be generated again by the importing
+// instance.
+func TestImportAdvancesSequentialGenerator(t *testing.T) {
+	gen, err := NewSequentialGenerator(4, DefaultAlphabet, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewMemoryStore()
+	h := NewHandler(store, Config{CodeGenerator: gen})
+
+	// aaab..aaal as exported by another instance, plus an unmarked alias
+	// that must not move the counter.
+	body := `[{"code": "zzzz", "url": "https://alias.example"}`
+	for _, code := range []string{"aaab", "aaac", "aaad", "aaae", "aaaf", "aaag", "aaah", "aaai", "aaaj", "aaak", "aaal"} {
+		body += `, {"code": "` + code + `", "url": "https://dest.example/` + code + `", "sequential": true}`
+	}
+	body += "]"
+	if w := do(h, http.MethodPost, "/api/import", body); w.Code != http.StatusOK {
+		t.Fatalf("import: status %d: %s", w.Code, w.Body)
+	}
+
+	w := do(h, http.MethodPost, "/api/shorten", `{"url": "https://new.example"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("shorten after import: status %d: %s", w.Code, w.Body)
+	}
+	var result ShortenResult
+	decodeData(t, w, &result)
+	if result.Code != "aaam" {
+		t.Errorf("code after import = %q, want %q", result.Code, "aaam")
+	}
+}
+
+func TestLinkRecordRoundTrip(t *testing.T) {
+	link := Link{Code: "aaab", URL: "https://dest.example", RedirectStatus: 301, ForwardQuery: true, Sequential: true, UTM: &UTM{Source: "news"}}
+	row := make(map[string]string, len(exportColumns))
+	for i, cell := range linkRecord(link) {
+		row[strings.ToLower(exportColumns[i])] = cell
+	}
+	got, err := linkFromRow(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Code != link.Code || got.RedirectStatus != 301 || !got.ForwardQuery || !got.Sequential || got.UTM.Source != "news" {
+		t.Errorf("round trip = %+v, want %+v", got, link)
+	}
+}
+
+// ImportLinks keeps owners; POST /api/import gives every link to the caller.
+func TestImportLinksKeepsOwners(t *testing.T) {
+	var buf bytes.Buffer
+	exported := []Link{
+		{Code: "alice1", URL: "https://a.example/", Owner: "alice"},
+		{Code: "bob1", URL: "https://b.example/", Owner: "bob"},
+	}
+	if err := WriteLinks(&buf, exported, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	links, rowErrs, err := ReadLinks(&buf, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewMemoryStore()
+	result := ImportLinks(context.Background(), store, links, ImportOptions{RowErrs: rowErrs})
+	if result.Imported != 2 || result.Failed != 0 {
+		t.Fatalf("ImportLinks = %+v", result)
+	}
+	for _, want := range exported {
+		if got, err := store.Get(want.Code); err != nil || got.Owner != want.Owner {
+			t.Errorf("Get(%s) = owner %q, %v, want %q", want.Code, got.Owner, err, want.Owner)
+		}
+	}
+
+	viaAPI := NewMemoryStore()
+	body, _ := json.Marshal(exported)
+	if w := do(NewHandler(viaAPI, Config{}), http.MethodPost, "/api/import", string(body)); w.Code != http.StatusOK {
+		t.Fatalf("import: status %d: %s", w.Code, w.Body)
+	}
+	if got, _ := viaAPI.Get("bob1"); got.Owner != "" {
+		t.Errorf("POST /api/import kept owner %q", got.Owner)
+	}
+}
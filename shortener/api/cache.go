@@ -0,0 +1,178 @@
+package api
+
+import (
+	"container/list"
+	"io"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is how many links CachedStore keeps by default.
+const DefaultCacheSize = 10000
+
+// CacheStats are the counters of a CachedStore since it was created.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Size      int
+	Capacity  int
+}
+
+// HitRatio is Hits / (Hits + Misses), or 0 before the first lookup.
+func (s CacheStats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// CachedStore is a read-through LRU cache in front of another Store, so
+// hot codes are served from memory. Writes go straight to the wrapped
+// store and drop the code from the cache. Misses are not cached, so a
+// code created later is found right away.
+//
+// It only pays off in front of a Store whose Get does I/O. MemoryStore and
+// FileStore answer Get from a map under a read lock, which is already
+// cheaper than the cache's exclusive lock and list update.
+type CachedStore struct {
+	store    Store
+	capacity int
+
+	mu    sync.Mutex
+	order *list.List // front is the most recently used; values are Link
+	items map[string]*list.Element
+	// writes counts invalidations. A miss only fills the cache if no
+	// write happened while it was reading the wrapped store, so a lookup
+	// racing an update cannot cache the old link.
+	writes uint64
+
+	hits, misses, evictions uint64
+}
+
+// NewCachedStore caches up to capacity links from store.
+func NewCachedStore(store Store, capacity int) *CachedStore {
+	return &CachedStore{
+		store:    store,
+		capacity: max(1, capacity),
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *CachedStore) Get(code string) (Link, error) {
+	c.mu.Lock()
+	if el, ok := c.items[code]; ok {
+		c.order.MoveToFront(el)
+		c.hits++
+		link := el.Value.(Link)
+		c.mu.Unlock()
+		return link, nil
+	}
+	c.misses++
+	writes := c.writes
+	c.mu.Unlock()
+
+	link, err := c.store.Get(code)
+	if err != nil {
+		return Link{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.writes != writes {
+		return link, nil
+	}
+	if el, ok := c.items[code]; ok {
+		el.Value = link
+		c.order.MoveToFront(el)
+		return link, nil
+	}
+	c.items[code] = c.order.PushFront(link)
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(Link).Code)
+		c.evictions++
+	}
+	return link, nil
+}
+
+// invalidate drops code after a write to the wrapped store.
+func (c *CachedStore) invalidate(code string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writes++
+	if el, ok := c.items[code]; ok {
+		c.order.Remove(el)
+		delete(c.items, code)
+	}
+}
+
+func (c *CachedStore) Save(link Link) error {
+	err := c.store.Save(link)
+	c.invalidate(link.Code)
+	return err
+}
+
+func (c *CachedStore) Update(link Link) error {
+	err := c.store.Update(link)
+	c.invalidate(link.Code)
+	return err
+}
+
+func (c *CachedStore) Modify(code string, change func(Link) (Link, error)) (Link, error) {
+	link, err := c.store.Modify(code, change)
+	c.invalidate(code)
+	return link, err
+}
+
+func (c *CachedStore) Delete(code string) error {
+	err := c.store.Delete(code)
+	c.invalidate(code)
+	return err
+}
+
+func (c *CachedStore) DeleteIfExpired(code string, now time.Time) (bool, error) {
+	deleted, err := c.store.DeleteIfExpired(code, now)
+	c.invalidate(code)
+	return deleted, err
+}
+
+// Ping checks the wrapped store when it can fail.
+func (c *CachedStore) Ping() error {
+	if p, ok := c.store.(pinger); ok {
+		return p.Ping()
+	}
+	return nil
+}
+
+// List always reads the wrapped store.
+func (c *CachedStore) List() ([]Link, error) {
+	return c.store.List()
+}
+
+func (c *CachedStore) Len() (int, error) {
+	return c.store.Len()
+}
+
+// Close closes the wrapped store if it has a Close method.
+func (c *CachedStore) Close() error {
+	if closer, ok := c.store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Stats returns the cache counters, reported on /metrics.
+func (c *CachedStore) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Size:      c.order.Len(),
+		Capacity:  c.capacity,
+	}
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// BenchmarkHandleGet measures redirects served straight from each backend
+// and through a CachedStore in front of it.
+func BenchmarkHandleGet(b *testing.B) {
+	const links = 1000
+
+	backends := map[string]func(b *testing.B) Store{
+		"memory": func(b *testing.B) Store { return NewMemoryStore() },
+		"file": func(b *testing.B) Store {
+			fs, err := OpenFileStore(filepath.Join(b.TempDir(), "links.db"))
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Cleanup(func() { fs.Close() })
+			return fs
+		},
+	}
+
+	for name, open := range backends {
+		for _, cached := range []bool{false, true} {
+			label := name
+			if cached {
+				label += "+cache"
+			}
+			b.Run(label, func(b *testing.B) {
+				store := open(b)
+				for i := 0; i < links; i++ {
+					code := fmt.Sprintf("c%d", i)
+					if err := store.Save(Link{Code: code, URL: "https://example.com/" + code, CreatedAt: time.Now()}); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if cached {
+					store = NewCachedStore(store, DefaultCacheSize)
+				}
+				analytics := NewAnalytics(DefaultAnalyticsBuffer)
+				defer analytics.Close()
+
+				r := chi.NewMux()
+				r.Get("/{code}", handleGet(store, analytics, nil))
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					i := 0
+					for pb.Next() {
+						req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/c%d", i%links), nil)
+						w := httptest.NewRecorder()
+						r.ServeHTTP(w, req)
+						if w.Code != http.StatusFound {
+							b.Fatalf("status %d, want %d", w.Code, http.StatusFound)
+						}
+						i++
+					}
+				})
+			})
+		}
+	}
+}
+
+func TestCachedStoreInvalidatesOnWrite(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	writes := map[string]func(c *CachedStore) error{
+		"update": func(c *CachedStore) error {
+			return c.Update(Link{Code: "abc", URL: "https://new.example/"})
+		},
+		"delete": func(c *CachedStore) error {
+			return c.Delete("abc")
+		},
+		"delete if expired": func(c *CachedStore) error {
+			_, err := c.DeleteIfExpired("abc", time.Now())
+			return err
+		},
+	}
+	for name, write := range writes {
+		t.Run(name, func(t *testing.T) {
+			backend := NewMemoryStore()
+			backend.Save(Link{Code: "abc", URL: "https://old.example/", ExpiresAt: &past})
+			c := NewCachedStore(backend, 10)
+			if _, err := c.Get("abc"); err != nil {
+				t.Fatal(err)
+			}
+			if c.Stats().Size != 1 {
+				t.Fatalf("link not cached after first Get")
+			}
+
+			if err := write(c); err != nil {
+				t.Fatal(err)
+			}
+			if c.Stats().Size != 0 {
+				t.Errorf("code still cached after %s", name)
+			}
+			want, wantErr := backend.Get("abc")
+			got, err := c.Get("abc")
+			if got != want || !errors.Is(err, wantErr) {
+				t.Errorf("Get after %s = %+v, %v, want %+v, %v", name, got, err, want, wantErr)
+			}
+		})
+	}
+}
+
+// blockingStore pauses Get after reading the link, so a test can write
+// while a cache miss is in flight.
+type blockingStore struct {
+	*MemoryStore
+	read, resume chan struct{}
+}
+
+func (s *blockingStore) Get(code string) (Link, error) {
+	link, err := s.MemoryStore.Get(code)
+	s.read <- struct{}{}
+	<-s.resume
+	return link, err
+}
+
+// A miss that read the old link before a concurrent Update must not put it
+// in the cache.
+func TestCachedStoreSkipsStaleFill(t *testing.T) {
+	backend := &blockingStore{MemoryStore: NewMemoryStore(), read: make(chan struct{}), resume: make(chan struct{})}
+	backend.Save(Link{Code: "abc", URL: "https://old.example/"})
+	c := NewCachedStore(backend, 10)
+
+	done := make(chan Link)
+	go func() {
+		link, _ := c.Get("abc")
+		done <- link
+	}()
+	<-backend.read
+	if err := c.Update(Link{Code: "abc", URL: "https://new.example/"}); err != nil {
+		t.Fatal(err)
+	}
+	close(backend.resume)
+
+	if stale := <-done; stale.URL != "https://old.example/" {
+		t.Fatalf("racing Get returned %q, want the old link", stale.URL)
+	}
+	if size := c.Stats().Size; size != 0 {
+		t.Fatalf("stale link cached: size %d", size)
+	}
+	go func() { <-backend.read }()
+	if got, _ := c.Get("abc"); got.URL != "https://new.example/" {
+		t.Errorf("Get after update = %q, want the new link", got.URL)
+	}
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultAlphabet is the base62 alphabet used for short codes.
+const DefaultAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// DefaultCodeLength is the length of random and hash-based codes.
+const DefaultCodeLength = 8
+
+// maxCodeAttempts bounds how many codes handlePost tries before giving up.
+const maxCodeAttempts = 10
+
+var ErrCodeSpaceExhausted = errors.New("could not generate a unique code")
+
+// CodeGenerator produces candidate short codes. attempt starts at 0 and is
+// incremented every time the previous candidate was already taken.
+type CodeGenerator interface {
+	Generate(url string, attempt int) (string, error)
+}
+
+// validateAlphabet rejects alphabets that would produce ambiguous or
+// unroutable codes.
+func validateAlphabet(alphabet string) error {
+	if len(alphabet) < 2 {
+		return fmt.Errorf("code alphabet needs at least 2 characters")
+	}
+	seen := make(map[byte]bool, len(alphabet))
+	for i := 0; i < len(alphabet); i++ {
+		c := alphabet[i]
+		if !isCodeChar(c) {
+			return fmt.Errorf("code alphabet may only contain letters, digits, '-' and '_', got %q", c)
+		}
+		if seen[c] {
+			return fmt.Errorf("code alphabet has duplicate character %q", c)
+		}
+		seen[c] = true
+	}
+	return nil
+}
+
+// isCodeChar reports whether c may appear in a short code or alias.
+func isCodeChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-' || c == '_'
+}
+
+// RandomGenerator picks each character uniformly with crypto/rand.
+type RandomGenerator struct {
+	length   int
+	alphabet string
+}
+
+func NewRandomGenerator(length int, alphabet string) (*RandomGenerator, error) {
+	if length < 1 {
+		return nil, fmt.Errorf("code length must be positive")
+	}
+	if err := validateAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+	return &RandomGenerator{length: length, alphabet: alphabet}, nil
+}
+
+func (g *RandomGenerator) Generate(string, int) (string, error) {
+	size := big.NewInt(int64(len(g.alphabet)))
+	byts := make([]byte, g.length)
+	for i := range byts {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", err
+		}
+		byts[i] = g.alphabet[n.Int64()]
+	}
+	return string(byts), nil
+}
+
+// SequentialGenerator encodes an increasing counter in the alphabet
+// (base62 with the default one), left-padded to minLength.
+type SequentialGenerator struct {
+	minLength int
+	alphabet  string
+	next      atomic.Uint64
+}
+
+// NewSequentialGenerator generates start+1 first. Pass SequentialStart of
+// the stored links so a restart does not walk through taken codes.
+func NewSequentialGenerator(minLength int, alphabet string, start uint64) (*SequentialGenerator, error) {
+	if minLength < 0 {
+		return nil, fmt.Errorf("code length must not be negative")
+	}
+	if err := validateAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+	g := &SequentialGenerator{minLength: minLength, alphabet: alphabet}
+	g.next.Store(start)
+	return g, nil
+}
+
+func (g *SequentialGenerator) Generate(string, int) (string, error) {
+	n := g.next.Add(1)
+	return encode(new(big.Int).SetUint64(n), g.alphabet, g.minLength), nil
+}
+
+// observe moves the counter past a code the generator made elsewhere, so
+// links imported from another instance are not generated again.
+func (g *SequentialGenerator) observe(code string) {
+	n, ok := decode(code, g.alphabet)
+	if !ok {
+		return
+	}
+	for {
+		current := g.next.Load()
+		if n <= current || g.next.CompareAndSwap(current, n) {
+			return
+		}
+	}
+}
+
+// SequentialStart is the highest counter value already used by links, read
+// back by decoding the codes of links marked Sequential. Counting links
+// instead would reuse codes once any is deleted, and decoding aliases
+// would let one like "promo2026" push the counter far ahead. Stores
+// written before the mark existed have no marked link; then every code in
+// alphabet is decoded, as the first marked code is generated past them.
+func SequentialStart(links []Link, alphabet string) uint64 {
+	var highest, legacy uint64
+	marked := false
+	for _, link := range links {
+		n, ok := decode(link.Code, alphabet)
+		if !ok {
+			continue
+		}
+		if link.Sequential {
+			marked = true
+			highest = max(highest, n)
+		} else {
+			legacy = max(legacy, n)
+		}
+	}
+	if !marked {
+		return legacy
+	}
+	return highest
+}
+
+// HashGenerator derives the code from a SHA-256 of the URL, so shortening
+// the same URL twice yields the same code. On collision with a different
+// URL the attempt number is mixed into the hash.
+type HashGenerator struct {
+	length   int
+	alphabet string
+}
+
+func NewHashGenerator(length int, alphabet string) (*HashGenerator, error) {
+	if length < 1 {
+		return nil, fmt.Errorf("code length must be positive")
+	}
+	if err := validateAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+	return &HashGenerator{length: length, alphabet: alphabet}, nil
+}
+
+func (g *HashGenerator) Generate(url string, attempt int) (string, error) {
+	input := url
+	if attempt > 0 {
+		input += "#" + strconv.Itoa(attempt)
+	}
+	sum := sha256.Sum256([]byte(input))
+	code := encode(new(big.Int).SetBytes(sum[:]), g.alphabet, g.length)
+	return code[len(code)-g.length:], nil
+}
+
+// deterministic tells handlePost that a collision with the same URL means
+// the link already exists and can be returned as is.
+func (g *HashGenerator) deterministic() bool { return true }
+
+// encode writes n in base len(alphabet), left-padded with alphabet[0].
+func encode(n *big.Int, alphabet string, minLength int) string {
+	base := big.NewInt(int64(len(alphabet)))
+	mod := new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, base, mod)
+		out = append(out, alphabet[mod.Int64()])
+	}
+	for len(out) < minLength {
+		out = append(out, alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// decode is the inverse of encode for values that fit in a uint64.
+func decode(code, alphabet string) (uint64, bool) {
+	base := uint64(len(alphabet))
+	var n uint64
+	for i := 0; i < len(code); i++ {
+		digit := strings.IndexByte(alphabet, code[i])
+		if digit < 0 || n > (math.MaxUint64-uint64(digit))/base {
+			return 0, false
+		}
+		n = n*base + uint64(digit)
+	}
+	return n, true
+}
+
+// NewCodeGenerator builds the generator for a strategy name:
+// "random", "sequential" or "hash". start is only used by "sequential".
+func NewCodeGenerator(strategy string, length int, alphabet string, start uint64) (CodeGenerator, error) {
+	switch strategy {
+	case "random":
+		return NewRandomGenerator(length, alphabet)
+	case "sequential":
+		return NewSequentialGenerator(length, alphabet, start)
+	case "hash":
+		return NewHashGenerator(length, alphabet)
+	default:
+		return nil, fmt.Errorf("unknown code strategy %q", strategy)
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestDecodeRoundTrip(t *testing.T) {
+	for _, n := range []uint64{0, 1, 61, 62, 3843, 1 << 40} {
+		code := encode(new(big.Int).SetUint64(n), DefaultAlphabet, 4)
+		if got, ok := decode(code, DefaultAlphabet); !ok || got != n {
+			t.Errorf("decode(%q) = %d, %v, want %d", code, got, ok, n)
+		}
+	}
+	for _, code := range []string{"a-b", "zzzzzzzzzzzzzzzzzzzzzzzzz"} {
+		if _, ok := decode(code, DefaultAlphabet); ok {
+			t.Errorf("decode(%q) succeeded", code)
+		}
+	}
+}
+
+// After deleting links, the counter must resume after the highest code
+// still stored instead of at the number of links.
+func TestSequentialStartAfterDeletes(t *testing.T) {
+	gen, err := NewSequentialGenerator(4, DefaultAlphabet, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var links []Link
+	for range 5 {
+		code, _ := gen.Generate("", 0)
+		links = append(links, Link{Code: code, Sequential: true})
+	}
+	// Keep only the last two, plus an alias outside the alphabet and one
+	// made only of base62 characters, which decodes far past the counter.
+	links = append(links[3:], Link{Code: "my-alias"}, Link{Code: "promo2026"})
+
+	restarted, err := NewSequentialGenerator(4, DefaultAlphabet, SequentialStart(links, DefaultAlphabet))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := restarted.Generate("", 0)
+	for _, l := range links {
+		if l.Code == code {
+			t.Fatalf("restarted generator produced taken code %q", code)
+		}
+	}
+	if want := "aaag"; code != want {
+		t.Errorf("first code after restart = %q, want %q", code, want)
+	}
+}
+
+// Links saved before the Sequential mark existed are all decoded.
+func TestSequentialStartUnmarked(t *testing.T) {
+	links := []Link{{Code: "aaab"}, {Code: "aaaf"}, {Code: "my-alias"}}
+	if got := SequentialStart(links, DefaultAlphabet); got != 5 {
+		t.Errorf("SequentialStart = %d, want 5", got)
+	}
+}
+
+func TestSaveWithNewCodeMarksSequential(t *testing.T) {
+	store := NewMemoryStore()
+	seq, _ := NewSequentialGenerator(4, DefaultAlphabet, 0)
+	random, _ := NewRandomGenerator(4, DefaultAlphabet)
+	for gen, want := range map[CodeGenerator]bool{seq: true, random: false} {
+		code, err := saveWithNewCode(store, gen, nil, Link{URL: "https://dest.example"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if link, _ := store.Get(code); link.Sequential != want {
+			t.Errorf("%T: Sequential = %v, want %v", gen, link.Sequential, want)
+		}
+	}
+}
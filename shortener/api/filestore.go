@@ -0,0 +1,367 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// logRecord is one line of the FileStore append-only log.
+type logRecord struct {
+	Op   string `json:"op"`
+	Link Link   `json:"link"`
+}
+
+const (
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+// FileStore is a durable Store backed by an append-only JSON lines file.
+//
+// Every change is appended as a single line and fsynced before the call
+// returns, so an acknowledged write survives a crash. On open the log is
+// replayed into memory; a torn last line (crash in the middle of a write)
+// is dropped and the file truncated back to the last complete record.
+// When the log holds more dead records than live links it is compacted
+// by writing a fresh snapshot to a temp file and renaming it over the log:
+// on open, and while running once at least compactMinDead records are dead.
+type FileStore struct {
+	mu    sync.RWMutex
+	path  string
+	file  *os.File
+	links map[string]Link
+	dead  int // records in the log that no longer describe a live link
+
+	compactMinDead int
+}
+
+// compactMinDead keeps a running store from rewriting a small log on
+// every few updates.
+const compactMinDead = 1000
+
+func OpenFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, links: make(map[string]Link), compactMinDead: compactMinDead}
+	if err := s.recover(); err != nil {
+		return nil, err
+	}
+	if s.dead > len(s.links) {
+		if err := s.compact(); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.file == nil {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("open store file: %w", err)
+		}
+		s.file = f
+	}
+	return s, nil
+}
+
+// recover replays the log into memory and truncates a torn tail.
+func (s *FileStore) recover() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return fmt.Errorf("open store file: %w", err)
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				slog.Warn("dropping incomplete record at end of store file", "path", s.path, "offset", offset)
+				if err := f.Truncate(offset); err != nil {
+					return fmt.Errorf("truncate store file: %w", err)
+				}
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read store file: %w", err)
+		}
+
+		var rec logRecord
+		if err := json.Unmarshal(bytes.TrimSpace(line), &rec); err != nil {
+			return fmt.Errorf("corrupt record in store file at offset %d: %w", offset, err)
+		}
+		s.apply(rec)
+		offset += int64(len(line))
+	}
+}
+
+func (s *FileStore) apply(rec logRecord) {
+	switch rec.Op {
+	case opPut:
+		if _, ok := s.links[rec.Link.Code]; ok {
+			s.dead++
+		}
+		s.links[rec.Link.Code] = rec.Link
+	case opDelete:
+		delete(s.links, rec.Link.Code)
+		s.dead += 2 // the delete record and the put it cancels
+	}
+}
+
+// compact rewrites the log with one put per live link and switches
+// appends over to the new file. Callers must hold s.mu, or be opening
+// the store.
+func (s *FileStore) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".compact-*")
+	if err != nil {
+		return fmt.Errorf("create compaction file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	for _, link := range s.links {
+		data, err := json.Marshal(logRecord{Op: opPut, Link: link})
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		w.Write(append(data, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write compaction file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync compaction file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// Opened before the rename, so the handle follows the new log.
+	f, err := os.OpenFile(tmp.Name(), os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open compaction file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		f.Close()
+		return fmt.Errorf("replace store file: %w", err)
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = f
+	s.dead = 0
+	return syncDir(filepath.Dir(s.path))
+}
+
+// maybeCompact compacts the log of a running store once enough of it is
+// dead. The write that got here has already succeeded, so a failure is
+// only logged; the next write tries again. Callers must hold s.mu.
+func (s *FileStore) maybeCompact() {
+	if s.dead < s.compactMinDead || s.dead <= len(s.links) {
+		return
+	}
+	if err := s.compact(); err != nil {
+		slog.Error("failed to compact store file", "path", s.path, "error", err)
+	}
+}
+
+// syncDir makes a rename inside dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("sync store directory: %w", err)
+	}
+	return nil
+}
+
+// append writes rec as one line and waits for it to reach the disk.
+// Callers must hold s.mu.
+//
+// If the write or the fsync fails, the file is truncated back to where it
+// ended, so a partial line cannot sit in the middle of the log and the
+// log never holds a change the caller was told had failed.
+func (s *FileStore) append(rec logRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	info, err := s.file.Stat()
+	if err != nil {
+		return fmt.Errorf("stat store file: %w", err)
+	}
+	end := info.Size()
+
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return s.rollback(end, fmt.Errorf("write store file: %w", err))
+	}
+	if err := s.file.Sync(); err != nil {
+		return s.rollback(end, fmt.Errorf("sync store file: %w", err))
+	}
+	return nil
+}
+
+// rollback truncates the log back to size after a failed append and
+// returns the error that caused it.
+func (s *FileStore) rollback(size int64, cause error) error {
+	if err := s.file.Truncate(size); err != nil {
+		slog.Error("failed to roll back store file", "path", s.path, "size", size, "error", err)
+		return errors.Join(cause, fmt.Errorf("truncate store file: %w", err))
+	}
+	return cause
+}
+
+func (s *FileStore) Save(link Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.links[link.Code]; ok {
+		return ErrCodeExists
+	}
+	if err := s.append(logRecord{Op: opPut, Link: link}); err != nil {
+		return err
+	}
+	s.links[link.Code] = link
+	return nil
+}
+
+func (s *FileStore) Get(code string) (Link, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	link, ok := s.links[code]
+	if !ok {
+		return Link{}, ErrNotFound
+	}
+	return link, nil
+}
+
+func (s *FileStore) Update(link Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.links[link.Code]; !ok {
+		return ErrNotFound
+	}
+	if err := s.append(logRecord{Op: opPut, Link: link}); err != nil {
+		return err
+	}
+	s.links[link.Code] = link
+	s.dead++
+	s.maybeCompact()
+	return nil
+}
+
+func (s *FileStore) Modify(code string, change func(Link) (Link, error)) (Link, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.links[code]
+	if !ok {
+		return Link{}, ErrNotFound
+	}
+	link, err := change(current)
+	if err != nil {
+		return Link{}, err
+	}
+	link.Code = code
+	if err := s.append(logRecord{Op: opPut, Link: link}); err != nil {
+		return Link{}, err
+	}
+	s.links[code] = link
+	s.dead++
+	s.maybeCompact()
+	return link, nil
+}
+
+func (s *FileStore) Delete(code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.links[code]; !ok {
+		return ErrNotFound
+	}
+	if err := s.append(logRecord{Op: opDelete, Link: Link{Code: code}}); err != nil {
+		return err
+	}
+	delete(s.links, code)
+	s.dead += 2
+	s.maybeCompact()
+	return nil
+}
+
+func (s *FileStore) DeleteIfExpired(code string, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	link, ok := s.links[code]
+	if !ok {
+		return false, ErrNotFound
+	}
+	if !link.Expired(now) {
+		return false, nil
+	}
+	if err := s.append(logRecord{Op: opDelete, Link: Link{Code: code}}); err != nil {
+		return false, err
+	}
+	delete(s.links, code)
+	s.dead += 2
+	s.maybeCompact()
+	return true, nil
+}
+
+func (s *FileStore) List() ([]Link, error) {
+	s.mu.RLock()
+	links := make([]Link, 0, len(s.links))
+	for _, link := range s.links {
+		links = append(links, link)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(links, func(i, j int) bool { return links[i].Code < links[j].Code })
+	return links, nil
+}
+
+func (s *FileStore) Len() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.links), nil
+}
+
+// Ping checks that the log is still open and is the file at the store
+// path, so a deleted or replaced log is noticed before writes are lost.
+func (s *FileStore) Ping() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	open, err := s.file.Stat()
+	if err != nil {
+		return fmt.Errorf("stat store file: %w", err)
+	}
+	onDisk, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("stat store file: %w", err)
+	}
+	if !os.SameFile(open, onDisk) {
+		return fmt.Errorf("store file %s was replaced", s.path)
+	}
+	return nil
+}
+
+// Close flushes and closes the log file.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.file.Sync(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func openTestFileStore(t *testing.T, path string) *FileStore {
+	t.Helper()
+	s, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// logLines counts the records in the log at path.
+func logLines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Count(data, []byte("\n"))
+}
+
+func TestFileStoreTruncatesTornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.db")
+	complete := `{"op":"put","link":{"code":"abc","url":"https://dest.example/"}}` + "\n"
+	torn := `{"op":"put","link":{"code":"xyz","ur`
+	if err := os.WriteFile(path, []byte(complete+torn), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := openTestFileStore(t, path)
+	if info, _ := os.Stat(path); info.Size() != int64(len(complete)) {
+		t.Errorf("file size %d after open, want %d", info.Size(), len(complete))
+	}
+	if _, err := s.Get("xyz"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("torn record replayed: %v", err)
+	}
+	if err := s.Save(Link{Code: "def", URL: "https://dest.example/"}); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	reopened := openTestFileStore(t, path)
+	if n, _ := reopened.Len(); n != 2 {
+		t.Errorf("reopened store has %d links, want 2", n)
+	}
+}
+
+func TestFileStoreRejectsCorruptRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.db")
+	if err := os.WriteFile(path, []byte("not json\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFileStore(path); err == nil {
+		t.Error("corrupt record in the middle of the log accepted")
+	}
+}
+
+func TestFileStoreRollback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.db")
+	s := openTestFileStore(t, path)
+	if err := s.Save(Link{Code: "abc", URL: "https://dest.example/"}); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(path)
+
+	// A write that stopped halfway leaves a partial line behind.
+	s.file.Write([]byte(`{"op":"put","li`))
+	cause := errors.New("disk full")
+	if err := s.rollback(info.Size(), cause); err != cause {
+		t.Errorf("rollback = %v, want %v", err, cause)
+	}
+	if after, _ := os.Stat(path); after.Size() != info.Size() {
+		t.Errorf("file size %d after rollback, want %d", after.Size(), info.Size())
+	}
+
+	// A failing write must not change the store either.
+	writable := s.file
+	readOnly, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.file = readOnly
+	if err := s.Save(Link{Code: "def", URL: "https://dest.example/"}); err == nil {
+		t.Error("Save succeeded on a read-only log")
+	}
+	s.file = writable
+	readOnly.Close()
+	if _, err := s.Get("def"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("failed Save left the link in memory: %v", err)
+	}
+
+	if err := s.Save(Link{Code: "ghi", URL: "https://dest.example/"}); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	reopened := openTestFileStore(t, path)
+	links, _ := reopened.List()
+	if len(links) != 2 || links[0].Code != "abc" || links[1].Code != "ghi" {
+		t.Errorf("reopened links = %+v, want abc and ghi", links)
+	}
+}
+
+func TestFileStoreCompactsOnOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.db")
+	s := openTestFileStore(t, path)
+	s.Save(Link{Code: "abc", URL: "https://dest.example/0"})
+	s.Save(Link{Code: "gone", URL: "https://dest.example/"})
+	for i := 1; i <= 5; i++ {
+		s.Update(Link{Code: "abc", URL: fmt.Sprintf("https://dest.example/%d", i)})
+	}
+	s.Delete("gone")
+	s.Close()
+	if n := logLines(t, path); n != 8 {
+		t.Fatalf("log has %d records before reopening, want 8", n)
+	}
+
+	reopened := openTestFileStore(t, path)
+	if n := logLines(t, path); n != 1 {
+		t.Errorf("log has %d records after reopening, want 1", n)
+	}
+	if link, _ := reopened.Get("abc"); link.URL != "https://dest.example/5" {
+		t.Errorf("compacted link URL = %q, want the last update", link.URL)
+	}
+	// Writes after compaction must land in the new log.
+	reopened.Save(Link{Code: "def", URL: "https://dest.example/"})
+	if n := logLines(t, path); n != 2 {
+		t.Errorf("log has %d records after a save, want 2", n)
+	}
+}
+
+func TestFileStoreCompactsWhileRunning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.db")
+	s := openTestFileStore(t, path)
+	s.compactMinDead = 10
+	s.Save(Link{Code: "abc", URL: "https://dest.example/"})
+	s.Save(Link{Code: "def", URL: "https://dest.example/"})
+
+	for i := 0; i < 9; i++ {
+		s.Update(Link{Code: "abc", URL: fmt.Sprintf("https://dest.example/%d", i)})
+	}
+	if n := logLines(t, path); n != 11 {
+		t.Fatalf("log has %d records below the threshold, want 11", n)
+	}
+	s.Update(Link{Code: "abc", URL: "https://dest.example/last"})
+	if n := logLines(t, path); n != 2 {
+		t.Errorf("log has %d records after reaching the threshold, want 2", n)
+	}
+
+	s.Delete("def")
+	s.Close()
+	reopened := openTestFileStore(t, path)
+	links, _ := reopened.List()
+	if len(links) != 1 || links[0].URL != "https://dest.example/last" {
+		t.Errorf("reopened links = %+v, want only the updated abc", links)
+	}
+}
+
+// Every field of a link must survive the log.
+func TestFileStoreReopenKeepsState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.db")
+	created := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+	expires := created.Add(72 * time.Hour)
+	links := []Link{
+		{Code: "abc", URL: "https://dest.example/a", CreatedAt: created},
+		{
+			Code: "full", URL: "https://dest.example/b?x=1", CreatedAt: created, ExpiresAt: &expires,
+			Owner: "alice", RedirectStatus: 308, Title: "Título", Disabled: true, DisabledReason: "abuse",
+			ForwardQuery: true, UTM: &UTM{Source: "news", Campaign: "launch"}, Sequential: true,
+		},
+		{Code: "gone", URL: "https://dest.example/c", CreatedAt: created},
+	}
+
+	s := openTestFileStore(t, path)
+	for _, link := range links {
+		if err := s.Save(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links[0].Title = "updated"
+	s.Update(links[0])
+	s.Delete("gone")
+	before, _ := s.List()
+	s.Close()
+
+	reopened := openTestFileStore(t, path)
+	after, _ := reopened.List()
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("after reopen:\n%+v\nwant:\n%+v", after, before)
+	}
+	if !reflect.DeepEqual(after, links[:2]) {
+		t.Errorf("after reopen:\n%+v\nwant:\n%+v", after, links[:2])
+	}
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// RunJanitor purges expired links from store every interval until ctx is
+// cancelled, dropping their stats from analytics. It is meant to be
+// started in its own goroutine.
+func RunJanitor(ctx context.Context, store Store, analytics *Analytics, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			purged, err := purgeExpired(store, analytics, now)
+			if err != nil {
+				slog.Error("failed to purge expired links", "error", err)
+				continue
+			}
+			if purged > 0 {
+				slog.Info("purged expired links", "count", purged)
+			}
+		}
+	}
+}
+
+// purgeExpired deletes every link that expired at or before now. The
+// expiry is checked again by DeleteIfExpired, so a link renewed after
+// List is kept.
+func purgeExpired(store Store, analytics *Analytics, now time.Time) (int, error) {
+	links, err := store.List()
+	if err != nil {
+		return 0, err
+	}
+
+	var purged int
+	for _, link := range links {
+		if !link.Expired(now) {
+			continue
+		}
+		deleted, err := store.DeleteIfExpired(link.Code, now)
+		// Someone else may have removed it between List and the delete.
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return purged, err
+		}
+		if deleted {
+			analytics.Forget(link.Code)
+			purged++
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPurgeExpired(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+	store := NewMemoryStore()
+	store.Save(Link{Code: "old", URL: "https://dest.example/", ExpiresAt: &past})
+	store.Save(Link{Code: "new", URL: "https://dest.example/", ExpiresAt: &future})
+	store.Save(Link{Code: "forever", URL: "https://dest.example/"})
+
+	analytics := NewAnalytics(DefaultAnalyticsBuffer)
+	for _, code := range []string{"old", "new"} {
+		analytics.Record(code, httptest.NewRequest(http.MethodGet, "/"+code, nil))
+	}
+	analytics.Close() // waits until the hits are aggregated
+
+	purged, err := purgeExpired(store, analytics, now)
+	if err != nil || purged != 1 {
+		t.Fatalf("purgeExpired = %d, %v, want 1", purged, err)
+	}
+	if n, _ := store.Len(); n != 2 {
+		t.Errorf("%d links left, want 2", n)
+	}
+	if _, err := store.Get("old"); err == nil {
+		t.Error("expired link kept")
+	}
+	if total := analytics.Stats("old").Total; total != 0 {
+		t.Errorf("stats of the purged link kept: %d hits", total)
+	}
+	if total := analytics.Stats("new").Total; total != 1 {
+		t.Errorf("stats of a live link = %d hits, want 1", total)
+	}
+}
+
+func TestRunJanitor(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	store := NewMemoryStore()
+	store.Save(Link{Code: "old", URL: "https://dest.example/", ExpiresAt: &past})
+	analytics := NewAnalytics(DefaultAnalyticsBuffer)
+	defer analytics.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		RunJanitor(ctx, store, analytics, time.Millisecond)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if n, _ := store.Len(); n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("janitor did not purge the expired link")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+}
@@ -0,0 +1,245 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// LinkPage is the payload of GET /api/links.
+type LinkPage struct {
+	Links  []Link `json:"links"`
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+// PatchBody lists the fields PATCH /api/links/{code} can change.
+// Fields left out of the JSON keep their current value.
+type PatchBody struct {
+	URL            *string `json:"url,omitempty"`
+	RedirectStatus *int    `json:"redirectStatus,omitempty"`
+	// Disabled turns the redirect off (451) without deleting the link.
+	Disabled       *bool   `json:"disabled,omitempty"`
+	DisabledReason *string `json:"disabledReason,omitempty"`
+	ForwardQuery   *bool   `json:"forwardQuery,omitempty"`
+	// UTM replaces the stored parameters; an empty object removes them.
+	UTM *UTM `json:"utm,omitempty"`
+}
+
+// sendStoreError answers with 404 for ErrNotFound and 500 otherwise.
+func sendStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrNotFound) {
+		sendJSON(w, Response{Error: err.Error()}, http.StatusNotFound)
+		return
+	}
+	slog.Error("store operation failed", "error", err)
+	sendJSON(w, Response{Error: "something went wrong"}, http.StatusInternalServerError)
+}
+
+// getOwnedLink loads the link named by the {code} URL parameter and checks
+// that it belongs to the caller. On failure it writes the error response
+// and returns false.
+func getOwnedLink(w http.ResponseWriter, r *http.Request, store Store) (Link, bool) {
+	link, err := store.Get(chi.URLParam(r, "code"))
+	if err != nil {
+		sendStoreError(w, err)
+		return Link{}, false
+	}
+	if link.Owner != ownerFromContext(r.Context()) {
+		sendJSON(w, Response{Error: errNotOwner.Error()}, http.StatusForbidden)
+		return Link{}, false
+	}
+	return link, true
+}
+
+// ownedLinks returns the links of the caller, sorted by code.
+func ownedLinks(r *http.Request, store Store) ([]Link, error) {
+	all, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	owner := ownerFromContext(r.Context())
+	links := make([]Link, 0, len(all))
+	for _, link := range all {
+		if link.Owner == owner {
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+// pageParam reads a non-negative integer query parameter.
+func pageParam(r *http.Request, name string, fallback int) (int, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		return 0, errors.New(name + " must be a non-negative integer")
+	}
+	return n, nil
+}
+
+func handleList(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, err := pageParam(r, "limit", defaultPageLimit)
+		if err != nil {
+			sendJSON(w, Response{Error: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		offset, err := pageParam(r, "offset", 0)
+		if err != nil {
+			sendJSON(w, Response{Error: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		if limit == 0 || limit > maxPageLimit {
+			limit = maxPageLimit
+		}
+
+		links, err := ownedLinks(r, store)
+		if err != nil {
+			sendStoreError(w, err)
+			return
+		}
+
+		page := LinkPage{Links: []Link{}, Total: len(links), Limit: limit, Offset: offset}
+		if offset < len(links) {
+			page.Links = links[offset:min(offset+limit, len(links))]
+		}
+		sendJSON(w, Response{Data: page}, http.StatusOK)
+	}
+}
+
+func handleInspect(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		link, ok := getOwnedLink(w, r, store)
+		if !ok {
+			return
+		}
+		sendJSON(w, Response{Data: link}, http.StatusOK)
+	}
+}
+
+func handlePatch(store Store, titles *TitleFetcher, checker URLChecker, baseURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body PatchBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			sendJSON(w, Response{Error: "invalid body"}, http.StatusUnprocessableEntity)
+			return
+		}
+
+		// Answers 404/403 before any destination is sent to the checker.
+		if _, ok := getOwnedLink(w, r, store); !ok {
+			return
+		}
+
+		// Everything that depends only on the body is checked outside the
+		// store lock, since the safety check may be remote.
+		var target string
+		if body.URL != nil {
+			var err error
+			target, err = normalizeURL(*body.URL, serviceHosts(r, baseURL)...)
+			if err != nil {
+				sendJSON(w, Response{Error: err.Error()}, http.StatusBadRequest)
+				return
+			}
+			if !checkNewURL(w, r, checker, target) {
+				return
+			}
+		}
+		if body.RedirectStatus != nil {
+			if err := validateRedirectStatus(*body.RedirectStatus); err != nil {
+				sendJSON(w, Response{Error: err.Error()}, http.StatusBadRequest)
+				return
+			}
+		}
+		var utm *UTM
+		if body.UTM != nil {
+			var err error
+			if utm, err = normalizeUTM(body.UTM); err != nil {
+				sendJSON(w, Response{Error: err.Error()}, http.StatusBadRequest)
+				return
+			}
+		}
+
+		owner := ownerFromContext(r.Context())
+		link, err := store.Modify(chi.URLParam(r, "code"), func(link Link) (Link, error) {
+			if link.Owner != owner {
+				return link, errNotOwner
+			}
+			if body.URL != nil && target != link.URL {
+				link.URL = target
+				link.Title = ""
+			}
+			if body.RedirectStatus != nil {
+				link.RedirectStatus = *body.RedirectStatus
+			}
+			if body.ForwardQuery != nil {
+				link.ForwardQuery = *body.ForwardQuery
+			}
+			if body.UTM != nil {
+				link.UTM = utm
+			}
+			if body.Disabled != nil {
+				link.Disabled = *body.Disabled
+				if !link.Disabled {
+					link.DisabledReason = ""
+				}
+			}
+			if body.DisabledReason != nil && link.Disabled {
+				link.DisabledReason = strings.TrimSpace(*body.DisabledReason)
+			}
+			return link, nil
+		})
+		if errors.Is(err, errNotOwner) {
+			sendJSON(w, Response{Error: err.Error()}, http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			sendStoreError(w, err)
+			return
+		}
+		if body.URL != nil && link.Title == "" {
+			titles.fetchAsync(store, link)
+		}
+		sendJSON(w, Response{Data: link}, http.StatusOK)
+	}
+}
+
+func handleDelete(store Store, analytics *Analytics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		link, ok := getOwnedLink(w, r, store)
+		if !ok {
+			return
+		}
+		code := link.Code
+		if err := store.Delete(code); err != nil {
+			sendStoreError(w, err)
+			return
+		}
+		analytics.Forget(code)
+		sendJSON(w, Response{Data: code}, http.StatusOK)
+	}
+}
+
+func handleStats(store Store, analytics *Analytics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		link, ok := getOwnedLink(w, r, store)
+		if !ok {
+			return
+		}
+		sendJSON(w, Response{Data: analytics.Stats(link.Code)}, http.StatusOK)
+	}
+}
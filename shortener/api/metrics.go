@@ -0,0 +1,240 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// redirectRoute is the route pattern whose latency goes to the histogram.
+const redirectRoute = "/{code}"
+
+// redirectBuckets are the upper bounds, in seconds, of the redirect
+// latency histogram.
+var redirectBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+type requestKey struct {
+	method, route string
+	status        int
+}
+
+// Metrics collects the numbers served on GET /metrics in the Prometheus
+// text exposition format.
+type Metrics struct {
+	mu       sync.Mutex
+	requests map[requestKey]uint64
+	// buckets[i] counts redirects up to redirectBuckets[i]; the last slot
+	// is +Inf. Counts are not cumulative until written out.
+	buckets       []uint64
+	redirectSum   float64
+	redirectCount uint64
+
+	collisions atomic.Uint64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests: make(map[requestKey]uint64),
+		buckets:  make([]uint64, len(redirectBuckets)+1),
+	}
+}
+
+// codeCollision counts a generated code that was already taken. A nil
+// Metrics ignores it.
+func (m *Metrics) codeCollision() {
+	if m != nil {
+		m.collisions.Add(1)
+	}
+}
+
+func (m *Metrics) observe(method, route string, status int, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{method, route, status}]++
+	if route != redirectRoute || method != http.MethodGet {
+		return
+	}
+	seconds := elapsed.Seconds()
+	i := sort.SearchFloat64s(redirectBuckets, seconds)
+	m.buckets[i]++
+	m.redirectSum += seconds
+	m.redirectCount++
+}
+
+// middleware records every request under its chi route pattern, so
+// /{code} is one series rather than one per short code.
+func (m *Metrics) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		m.observe(r.Method, route, status, time.Since(start))
+	})
+}
+
+// write renders the metrics. Store size and analytics are read at scrape
+// time rather than tracked on every change.
+func (m *Metrics) write(w io.Writer, store Store, analytics *Analytics) error {
+	links, err := store.Len()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	counts := make(map[requestKey]uint64, len(m.requests))
+	for k, v := range m.requests {
+		counts[k] = v
+	}
+	buckets := append([]uint64(nil), m.buckets...)
+	sum, count := m.redirectSum, m.redirectCount
+	m.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+
+	bw := bufio.NewWriter(w)
+	header(bw, "shortener_http_requests_total", "counter", "HTTP requests by method, route pattern and status.")
+	for _, k := range keys {
+		fmt.Fprintf(bw, "shortener_http_requests_total{method=%s,route=%s,status=\"%d\"} %d\n",
+			label(k.method), label(k.route), k.status, counts[k])
+	}
+
+	header(bw, "shortener_redirect_duration_seconds", "histogram", "Time to answer GET /{code}.")
+	var cumulative uint64
+	for i, le := range redirectBuckets {
+		cumulative += buckets[i]
+		fmt.Fprintf(bw, "shortener_redirect_duration_seconds_bucket{le=\"%s\"} %d\n", strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	cumulative += buckets[len(redirectBuckets)]
+	fmt.Fprintf(bw, "shortener_redirect_duration_seconds_bucket{le=\"+Inf\"} %d\n", cumulative)
+	fmt.Fprintf(bw, "shortener_redirect_duration_seconds_sum %s\n", strconv.FormatFloat(sum, 'g', -1, 64))
+	fmt.Fprintf(bw, "shortener_redirect_duration_seconds_count %d\n", count)
+
+	header(bw, "shortener_links", "gauge", "Links in the store, expired ones not yet purged included.")
+	fmt.Fprintf(bw, "shortener_links %d\n", links)
+
+	header(bw, "shortener_code_collisions_total", "counter", "Generated short codes that were already taken and had to be retried.")
+	fmt.Fprintf(bw, "shortener_code_collisions_total %d\n", m.collisions.Load())
+
+	if cached, ok := store.(*CachedStore); ok {
+		writeCacheMetrics(bw, cached.Stats())
+	}
+
+	header(bw, "shortener_analytics_dropped_hits_total", "counter", "Redirect hits dropped because the analytics buffer was full.")
+	fmt.Fprintf(bw, "shortener_analytics_dropped_hits_total %d\n", analytics.Dropped())
+
+	return bw.Flush()
+}
+
+func writeCacheMetrics(w io.Writer, s CacheStats) {
+	header(w, "shortener_cache_hits_total", "counter", "Link lookups served from the cache.")
+	fmt.Fprintf(w, "shortener_cache_hits_total %d\n", s.Hits)
+	header(w, "shortener_cache_misses_total", "counter", "Link lookups that went to the store.")
+	fmt.Fprintf(w, "shortener_cache_misses_total %d\n", s.Misses)
+	header(w, "shortener_cache_evictions_total", "counter", "Links evicted to stay within the cache capacity.")
+	fmt.Fprintf(w, "shortener_cache_evictions_total %d\n", s.Evictions)
+	header(w, "shortener_cache_size", "gauge", "Links currently cached.")
+	fmt.Fprintf(w, "shortener_cache_size %d\n", s.Size)
+	header(w, "shortener_cache_capacity", "gauge", "Maximum number of cached links.")
+	fmt.Fprintf(w, "shortener_cache_capacity %d\n", s.Capacity)
+	header(w, "shortener_cache_hit_ratio", "gauge", "Hits over all lookups since start.")
+	fmt.Fprintf(w, "shortener_cache_hit_ratio %s\n", strconv.FormatFloat(s.HitRatio(), 'g', 4, 64))
+}
+
+func header(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// label quotes a label value as the exposition format requires.
+func label(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
+
+func handleMetrics(m *Metrics, store Store, analytics *Analytics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := m.write(w, store, analytics); err != nil {
+			slog.Error("failed to write metrics", "error", err)
+		}
+	}
+}
+
+// handleHealthz is the liveness probe: the process is up and serving.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, "ok\n")
+}
+
+// Readiness tells /readyz that the server is shutting down, so a load
+// balancer stops routing to it while in-flight requests drain.
+type Readiness struct {
+	draining atomic.Bool
+}
+
+// Drain makes /readyz answer 503 from now on.
+func (r *Readiness) Drain() { r.draining.Store(true) }
+
+// pinger is implemented by stores that can fail, like a FileStore whose
+// file went away. Stores without it are always ready.
+type pinger interface {
+	Ping() error
+}
+
+// handleReadyz is the readiness probe: the server is not draining and the
+// store is usable. It pings the store directly rather than looking a code
+// up, which could not fail on the in-memory backends and would count as a
+// miss behind a CachedStore.
+func handleReadyz(store Store, readiness *Readiness) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if readiness.draining.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, "shutting down\n")
+			return
+		}
+		if p, ok := store.(pinger); ok {
+			if err := p.Ping(); err != nil {
+				slog.Error("readiness check failed", "error", err)
+				w.WriteHeader(http.StatusServiceUnavailable)
+				io.WriteString(w, "store unavailable\n")
+				return
+			}
+		}
+		io.WriteString(w, "ok\n")
+	}
+}
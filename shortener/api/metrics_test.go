@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadyz(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.db")
+	fs, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	cached := NewCachedStore(fs, 10)
+	readiness := &Readiness{}
+	h := NewHandler(cached, Config{Readiness: readiness})
+
+	if w := do(h, http.MethodGet, "/readyz", ""); w.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if stats := cached.Stats(); stats.Hits+stats.Misses != 0 {
+		t.Errorf("readiness probe went through the cache: %+v", stats)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if w := do(h, http.MethodGet, "/readyz", ""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("store file removed: status %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestReadyzDraining(t *testing.T) {
+	readiness := &Readiness{}
+	h := NewHandler(NewMemoryStore(), Config{Readiness: readiness})
+	if w := do(h, http.MethodGet, "/readyz", ""); w.Code != http.StatusOK {
+		t.Fatalf("status %d before draining, want %d", w.Code, http.StatusOK)
+	}
+	readiness.Drain()
+	if w := do(h, http.MethodGet, "/readyz", ""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status %d while draining, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if w := do(h, http.MethodGet, "/healthz", ""); w.Code != http.StatusOK {
+		t.Errorf("liveness status %d while draining, want %d", w.Code, http.StatusOK)
+	}
+}
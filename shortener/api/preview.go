@@ -0,0 +1,45 @@
+package api
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+)
+
+// previewSuffix appended to a short code (GET /{code}+) shows the preview
+// page instead of redirecting.
+const previewSuffix = "+"
+
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="pt-BR">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Prévia de /{{.Code}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 40rem; margin: 4rem auto; padding: 0 1rem; color: #222; }
+.url { word-break: break-all; font-family: monospace; background: #f4f4f4; padding: .75rem; border-radius: .25rem; }
+a.button { display: inline-block; margin-top: 1.5rem; padding: .75rem 1.5rem; background: #0b5fff; color: #fff; text-decoration: none; border-radius: .25rem; }
+</style>
+</head>
+<body>
+<h1>Este link leva para</h1>
+{{with .Title}}<p><strong>{{.}}</strong></p>{{end}}
+<p class="url">{{.URL}}</p>
+<p><small>Criado em {{.CreatedAt.Format "02/01/2006 15:04 MST"}}</small></p>
+<a class="button" href="/{{.Code}}" rel="noreferrer">Continuar</a>
+</body>
+</html>
+`))
+
+// servePreview renders the interstitial page for link. The continue button
+// goes through the normal redirect, so the visit is counted only then.
+func servePreview(w http.ResponseWriter, link Link) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	if err := previewPage.Execute(w, link); err != nil {
+		slog.Error("failed to render preview page", "code", link.Code, "error", err)
+	}
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"rsc.io/qr"
+)
+
+const (
+	defaultQRSize = 256
+	minQRSize     = 64
+	maxQRSize     = 2048
+	// qrQuietZone is the white border, in modules, scanners need around
+	// the code.
+	qrQuietZone = 4
+)
+
+var (
+	errQRFormat = errors.New("format must be png or svg")
+	errQRSize   = fmt.Errorf("size must be between %d and %d pixels", minQRSize, maxQRSize)
+	errQRLevel  = errors.New("level must be L, M, Q or H")
+)
+
+var qrLevels = map[string]qr.Level{
+	"L": qr.L,
+	"M": qr.M,
+	"Q": qr.Q,
+	"H": qr.H,
+}
+
+// shortURL is the absolute URL that redirects to code: baseURL + "/" + code,
+// or when baseURL is empty, built from the scheme and host the request
+// arrived on.
+func shortURL(baseURL string, r *http.Request, code string) string {
+	if baseURL != "" {
+		return baseURL + "/" + code
+	}
+	scheme := "http"
+	if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/" + code
+}
+
+// handleQR renders the short URL of a link as a QR code. Query parameters:
+// format (png or svg, default png), size (side in pixels, default 256)
+// and level (error correction L, M, Q or H, default M).
+func handleQR(store Store, baseURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		format := strings.ToLower(query.Get("format"))
+		if format == "" {
+			format = "png"
+		}
+		if format != "png" && format != "svg" {
+			sendJSON(w, Response{Error: errQRFormat.Error()}, http.StatusBadRequest)
+			return
+		}
+
+		size := defaultQRSize
+		if raw := query.Get("size"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < minQRSize || n > maxQRSize {
+				sendJSON(w, Response{Error: errQRSize.Error()}, http.StatusBadRequest)
+				return
+			}
+			size = n
+		}
+
+		level := qr.M
+		if raw := query.Get("level"); raw != "" {
+			l, ok := qrLevels[strings.ToUpper(raw)]
+			if !ok {
+				sendJSON(w, Response{Error: errQRLevel.Error()}, http.StatusBadRequest)
+				return
+			}
+			level = l
+		}
+
+		link, ok := getOwnedLink(w, r, store)
+		if !ok {
+			return
+		}
+
+		code, err := qr.Encode(shortURL(baseURL, r, link.Code), level)
+		if err != nil {
+			slog.Error("failed to encode qr code", "code", link.Code, "error", err)
+			sendJSON(w, Response{Error: "something went wrong"}, http.StatusInternalServerError)
+			return
+		}
+
+		var buf bytes.Buffer
+		if format == "svg" {
+			w.Header().Set("Content-Type", "image/svg+xml")
+			writeQRSVG(&buf, code, size)
+		} else {
+			w.Header().Set("Content-Type", "image/png")
+			if err := png.Encode(&buf, qrImage(code, size)); err != nil {
+				slog.Error("failed to encode qr png", "code", link.Code, "error", err)
+				sendJSON(w, Response{Error: "something went wrong"}, http.StatusInternalServerError)
+				return
+			}
+		}
+		w.Header().Set("Cache-Control", "private, max-age=300")
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			slog.Error("failed to write qr code", "error", err)
+		}
+	}
+}
+
+// qrScale is how many pixels each module takes so that the code plus its
+// quiet zone fits in size. Codes never shrink below one pixel per module.
+func qrScale(code *qr.Code, size int) int {
+	return max(1, size/(code.Size+2*qrQuietZone))
+}
+
+// qrImage draws code with whole-pixel modules, centered on a white square
+// of side size (or larger, if the code does not fit).
+func qrImage(code *qr.Code, size int) image.Image {
+	scale := qrScale(code, size)
+	side := max(size, (code.Size+2*qrQuietZone)*scale)
+	offset := (side - code.Size*scale) / 2
+
+	img := image.NewPaletted(image.Rect(0, 0, side, side), color.Palette{color.White, color.Black})
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if !code.Black(x, y) {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				row := img.Pix[(offset+y*scale+dy)*img.Stride:]
+				for dx := 0; dx < scale; dx++ {
+					row[offset+x*scale+dx] = 1
+				}
+			}
+		}
+	}
+	return img
+}
+
+// writeQRSVG writes code as an SVG path in module units, so it scales
+// without blurring; size only sets the rendered width and height.
+func writeQRSVG(buf *bytes.Buffer, code *qr.Code, size int) {
+	side := code.Size + 2*qrQuietZone
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, side, side)
+	fmt.Fprintf(buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, side, side)
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if !code.Black(x, y) {
+				continue
+			}
+			// Merge horizontal runs to keep the path short.
+			run := 1
+			for x+run < code.Size && code.Black(x+run, y) {
+				run++
+			}
+			fmt.Fprintf(buf, "M%d %dh%dv1h-%dz", x+qrQuietZone, y+qrQuietZone, run, run)
+			x += run - 1
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often idle buckets are dropped from memory.
+const sweepInterval = time.Minute
+
+// RateLimit configures a token bucket: Rate tokens are added per second,
+// up to Burst. The zero value disables limiting.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l RateLimit) enabled() bool { return l.Rate > 0 && l.Burst > 0 }
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps one token bucket per client key.
+type rateLimiter struct {
+	limit     RateLimit
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	return &rateLimiter{limit: limit, buckets: make(map[string]*bucket)}
+}
+
+// allow takes a token from key's bucket. When the bucket is empty it
+// returns false and how long until the next token is available.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	return l.allowN(key, 1, now)
+}
+
+// allowN takes n tokens from key's bucket, or none if it holds fewer.
+// n must not exceed the burst, or it never succeeds.
+func (l *rateLimiter) allowN(key string, n int, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > sweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(float64(l.limit.Burst), b.tokens+elapsed*l.limit.Rate)
+	b.last = now
+
+	if b.tokens >= float64(n) {
+		b.tokens -= float64(n)
+		return true, 0
+	}
+	wait := (float64(n) - b.tokens) / l.limit.Rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// sweep drops buckets that have refilled completely, since a new bucket
+// would be identical. Callers must hold l.mu.
+func (l *rateLimiter) sweep(now time.Time) {
+	full := time.Duration(float64(l.limit.Burst) / l.limit.Rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > full {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// clientKey identifies the caller: the API key owner when the request is
+// authenticated, the client IP otherwise.
+func clientKey(r *http.Request) string {
+	if owner := ownerFromContext(r.Context()); owner != "" {
+		return "owner:" + owner
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// rateLimit rejects requests over limit with 429 Too Many Requests and a
+// Retry-After header (in whole seconds, rounded up).
+func rateLimit(limit RateLimit) func(http.Handler) http.Handler {
+	if !limit.enabled() {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	limiter := newRateLimiter(limit)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ok, wait := limiter.allow(clientKey(r), time.Now()); !ok {
+				sendTooManyRequests(w, wait)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// itemLimiter charges a request one token per item it carries, once the
+// body is parsed and the count is known. A nil itemLimiter allows all.
+type itemLimiter struct {
+	*rateLimiter
+}
+
+func newItemLimiter(limit RateLimit) *itemLimiter {
+	if !limit.enabled() {
+		return nil
+	}
+	return &itemLimiter{newRateLimiter(limit)}
+}
+
+// take charges n tokens to the caller of r. On failure it has already
+// answered: 413 when n can never fit in the burst, 429 otherwise.
+func (l *itemLimiter) take(w http.ResponseWriter, r *http.Request, n int) bool {
+	if l == nil {
+		return true
+	}
+	if n > l.limit.Burst {
+		sendJSON(w, Response{Error: fmt.Sprintf("at most %d items per request", l.limit.Burst)}, http.StatusRequestEntityTooLarge)
+		return false
+	}
+	if ok, wait := l.allowN(clientKey(r), n, time.Now()); !ok {
+		sendTooManyRequests(w, wait)
+		return false
+	}
+	return true
+}
+
+func sendTooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(1, seconds)))
+	sendJSON(w, Response{Error: "too many requests"}, http.StatusTooManyRequests)
+}
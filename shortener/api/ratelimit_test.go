@@ -0,0 +1,121 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBulkChargesOneTokenPerItem(t *testing.T) {
+	h := NewHandler(NewMemoryStore(), Config{BulkLimit: RateLimit{Rate: 0.001, Burst: 3}})
+	bulk := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten/bulk", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := bulk(`["https://a.example", "https://b.example", "https://c.example", "https://d.example"]`); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("batch over the burst: status %d, want %d", code, http.StatusRequestEntityTooLarge)
+	}
+	if code := bulk(`["https://a.example", "https://b.example"]`); code != http.StatusOK {
+		t.Errorf("first batch: status %d, want %d", code, http.StatusOK)
+	}
+	if code := bulk(`["https://c.example", "https://d.example"]`); code != http.StatusTooManyRequests {
+		t.Errorf("second batch: status %d, want %d", code, http.StatusTooManyRequests)
+	}
+	if code := bulk(`["https://e.example"]`); code != http.StatusOK {
+		t.Errorf("last token: status %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestImportIsRateLimited(t *testing.T) {
+	h := NewHandler(NewMemoryStore(), Config{ImportLimit: RateLimit{Rate: 0.001, Burst: 1}})
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodPost, "/api/import", strings.NewReader(`[]`))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("import %d: status %d, want %d", i, w.Code, want)
+		}
+	}
+}
+
+func TestRateLimitedRoutes(t *testing.T) {
+	store := NewMemoryStore()
+	store.Save(Link{Code: "abc", URL: "https://dest.example/"})
+	limit := RateLimit{Rate: 0.001, Burst: 1}
+	h := NewHandler(store, Config{ShortenLimit: limit, RedirectLimit: limit})
+
+	routes := []struct {
+		method, target, body string
+		ok                   int
+	}{
+		{http.MethodPost, "/api/shorten", `{"url": "https://dest.example/"}`, http.StatusCreated},
+		{http.MethodGet, "/abc", "", http.StatusFound},
+	}
+	for _, rt := range routes {
+		if w := do(h, rt.method, rt.target, rt.body); w.Code != rt.ok {
+			t.Fatalf("%s %s: status %d, want %d", rt.method, rt.target, w.Code, rt.ok)
+		}
+		w := do(h, rt.method, rt.target, rt.body)
+		if w.Code != http.StatusTooManyRequests {
+			t.Fatalf("%s %s over the limit: status %d, want %d", rt.method, rt.target, w.Code, http.StatusTooManyRequests)
+		}
+		// One token every 1000s.
+		if got := w.Header().Get("Retry-After"); got != "1000" {
+			t.Errorf("%s %s: Retry-After = %q, want %q", rt.method, rt.target, got, "1000")
+		}
+	}
+}
+
+// Clients behind a trusted proxy get their own buckets; X-Forwarded-For
+// from anyone else is ignored.
+func TestRateLimitBehindProxy(t *testing.T) {
+	store := NewMemoryStore()
+	store.Save(Link{Code: "abc", URL: "https://dest.example/"})
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(store, Config{RedirectLimit: RateLimit{Rate: 0.001, Burst: 1}, TrustedProxies: proxies})
+
+	get := func(remoteAddr, forwardedFor string) int {
+		r := httptest.NewRequest(http.MethodGet, "/abc", nil)
+		r.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		return doRequest(h, r).Code
+	}
+
+	tests := []struct {
+		name, remoteAddr, forwardedFor string
+		want                           int
+	}{
+		{"first client", "10.1.1.1:5000", "203.0.113.1", http.StatusFound},
+		{"second client", "10.1.1.1:5000", "203.0.113.2", http.StatusFound},
+		{"first client again", "10.2.2.2:5000", "203.0.113.1", http.StatusTooManyRequests},
+		{"forged hop", "10.1.1.1:5000", "203.0.113.9, 203.0.113.1", http.StatusTooManyRequests},
+		{"chained proxies", "192.0.2.1:5000", "203.0.113.3, 10.3.3.3", http.StatusFound},
+		{"untrusted peer", "198.51.100.1:5000", "203.0.113.4", http.StatusFound},
+		{"untrusted peer forging", "198.51.100.1:5000", "203.0.113.5", http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		if got := get(tt.remoteAddr, tt.forwardedFor); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	if _, err := ParseTrustedProxies("10.0.0.0/8,::1, "); err != nil {
+		t.Errorf("valid list: %v", err)
+	}
+	for _, bad := range []string{"10.0.0.0/33", "proxy.local"} {
+		if _, err := ParseTrustedProxies(bad); err == nil {
+			t.Errorf("ParseTrustedProxies(%q) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DefaultRedirectStatus is used for links that do not choose one. It is a
+// temporary redirect so browsers ask again and PATCHed targets take effect.
+const DefaultRedirectStatus = http.StatusFound
+
+// permanentCacheAge is how long browsers may cache a 301/308 redirect.
+const permanentCacheAge = 24 * time.Hour
+
+var errRedirectStatus = errors.New("redirectStatus must be 301, 302, 307 or 308")
+
+// validateRedirectStatus accepts 0 (use the default) or one of the
+// redirect codes browsers follow automatically.
+func validateRedirectStatus(status int) error {
+	switch status {
+	case 0, http.StatusMovedPermanently, http.StatusFound,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return nil
+	}
+	return errRedirectStatus
+}
+
+// redirectStatus returns the status handleGet answers with.
+func (l Link) redirectStatus() int {
+	if l.RedirectStatus == 0 {
+		return DefaultRedirectStatus
+	}
+	return l.RedirectStatus
+}
+
+// setRedirectCacheHeaders tells browsers and proxies how long the redirect
+// may be reused. Temporary redirects are never cached; permanent ones are
+// cached for a day at most, and never beyond the link's expiration.
+func setRedirectCacheHeaders(w http.ResponseWriter, link Link, now time.Time) {
+	status := link.redirectStatus()
+	if status == http.StatusFound || status == http.StatusTemporaryRedirect {
+		w.Header().Set("Cache-Control", "private, no-cache, no-store, max-age=0")
+		return
+	}
+
+	age := permanentCacheAge
+	if link.ExpiresAt != nil {
+		age = min(age, link.ExpiresAt.Sub(now))
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(age.Seconds())))
+}
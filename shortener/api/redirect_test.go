@@ -0,0 +1,77 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRedirectCacheHeaders(t *testing.T) {
+	soon := time.Now().Add(time.Hour)
+	store := NewMemoryStore()
+	h := NewHandler(store, Config{})
+
+	const noCache = "private, no-cache, no-store, max-age=0"
+	day := fmt.Sprintf("public, max-age=%d", int(permanentCacheAge.Seconds()))
+	const capped = "capped at expiry"
+	tests := []struct {
+		name         string
+		link         Link
+		status       int
+		cacheControl string
+	}{
+		{"default", Link{}, http.StatusFound, noCache},
+		{"302", Link{RedirectStatus: 302}, http.StatusFound, noCache},
+		{"307", Link{RedirectStatus: 307}, http.StatusTemporaryRedirect, noCache},
+		{"301", Link{RedirectStatus: 301}, http.StatusMovedPermanently, day},
+		{"308", Link{RedirectStatus: 308}, http.StatusPermanentRedirect, day},
+		{"301 expiring", Link{RedirectStatus: 301, ExpiresAt: &soon}, http.StatusMovedPermanently, capped},
+		{"308 expiring", Link{RedirectStatus: 308, ExpiresAt: &soon}, http.StatusPermanentRedirect, capped},
+		{"302 expiring", Link{ExpiresAt: &soon}, http.StatusFound, noCache},
+	}
+	for i, tt := range tests {
+		tt.link.Code = fmt.Sprintf("code%d", i)
+		tt.link.URL = "https://dest.example/"
+		store.Save(tt.link)
+
+		w := do(h, http.MethodGet, "/"+tt.link.Code, "")
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.status)
+		}
+		got := w.Header().Get("Cache-Control")
+		if tt.cacheControl == capped {
+			var age int
+			if _, err := fmt.Sscanf(got, "public, max-age=%d", &age); err != nil || age > 3600 || age < 3500 {
+				t.Errorf("%s: Cache-Control %q, want max-age just under an hour", tt.name, got)
+			}
+		} else if got != tt.cacheControl {
+			t.Errorf("%s: Cache-Control %q, want %q", tt.name, got, tt.cacheControl)
+		}
+		if got := w.Header().Get("Location"); got != tt.link.URL {
+			t.Errorf("%s: Location %q, want %q", tt.name, got, tt.link.URL)
+		}
+	}
+}
+
+func TestRedirectStatusValidation(t *testing.T) {
+	store := NewMemoryStore()
+	store.Save(Link{Code: "abc", URL: "https://dest.example/"})
+	h := NewHandler(store, Config{})
+
+	for _, status := range []int{200, 300, 303, 304, 404, -1} {
+		body := fmt.Sprintf(`{"url": "https://dest.example/", "redirectStatus": %d}`, status)
+		if w := do(h, http.MethodPost, "/api/shorten", body); w.Code != http.StatusBadRequest {
+			t.Errorf("POST redirectStatus %d: status %d, want %d", status, w.Code, http.StatusBadRequest)
+		}
+		if w := do(h, http.MethodPatch, "/api/links/abc", fmt.Sprintf(`{"redirectStatus": %d}`, status)); w.Code != http.StatusBadRequest {
+			t.Errorf("PATCH redirectStatus %d: status %d, want %d", status, w.Code, http.StatusBadRequest)
+		}
+	}
+	if w := do(h, http.MethodPatch, "/api/links/abc", `{"redirectStatus": 308}`); w.Code != http.StatusOK {
+		t.Fatalf("PATCH redirectStatus 308: status %d", w.Code)
+	}
+	if w := do(h, http.MethodGet, "/abc", ""); w.Code != http.StatusPermanentRedirect {
+		t.Errorf("GET after PATCH: status %d, want %d", w.Code, http.StatusPermanentRedirect)
+	}
+}
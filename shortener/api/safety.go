@@ -0,0 +1,277 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// blocklistReloadInterval is how often the blocklist file is checked
+	// for changes while the server is running.
+	blocklistReloadInterval = time.Second
+	webhookTimeout          = 2 * time.Second
+)
+
+var (
+	errURLBlocked        = errors.New("url is blocked")
+	errSafetyUnavailable = errors.New("could not verify url safety, try again later")
+)
+
+// URLChecker decides whether a destination may be shortened or followed.
+// Check returns a non-empty reason when target is unsafe, and an error
+// only when it could not reach a verdict.
+type URLChecker interface {
+	Check(ctx context.Context, target string) (reason string, err error)
+}
+
+// CheckerFunc adapts a function to URLChecker, which is handy for fakes.
+type CheckerFunc func(ctx context.Context, target string) (string, error)
+
+func (f CheckerFunc) Check(ctx context.Context, target string) (string, error) {
+	return f(ctx, target)
+}
+
+// MultiChecker asks each checker in order and stops at the first one that
+// blocks target or fails.
+type MultiChecker []URLChecker
+
+func (m MultiChecker) Check(ctx context.Context, target string) (string, error) {
+	for _, c := range m {
+		if reason, err := c.Check(ctx, target); reason != "" || err != nil {
+			return reason, err
+		}
+	}
+	return "", nil
+}
+
+// Blocklist blocks destinations listed in a text file, one rule per line:
+//
+//	evil.example          # the domain and all its subdomains
+//	re:^https?://[^/]+/wp-login\.php   # a regexp matched against the full URL
+//
+// Blank lines and text after '#' are ignored. The file is reloaded when its
+// modification time changes, so it can be edited while the server runs.
+//
+// Check runs on every redirect, so it takes no lock: the rules are swapped
+// atomically on reload, and at most one caller per blocklistReloadInterval
+// stats the file.
+type Blocklist struct {
+	path      string
+	rules     atomic.Pointer[blocklistRules]
+	checkedAt atomic.Int64 // unix nanoseconds of the last reload check
+	reloading sync.Mutex
+}
+
+type blocklistRules struct {
+	domains  map[string]bool
+	patterns []*regexp.Regexp
+	modTime  time.Time
+}
+
+// OpenBlocklist loads the rules in path. A missing file blocks nothing.
+func OpenBlocklist(path string) (*Blocklist, error) {
+	b := &Blocklist{path: path}
+	if err := b.load(); err != nil {
+		return nil, err
+	}
+	b.checkedAt.Store(time.Now().UnixNano())
+	return b, nil
+}
+
+func (b *Blocklist) load() error {
+	info, err := os.Stat(b.path)
+	if errors.Is(err, os.ErrNotExist) {
+		b.rules.Store(&blocklistRules{})
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("stat blocklist: %w", err)
+	}
+
+	data, err := os.ReadFile(b.path)
+	if err != nil {
+		return fmt.Errorf("read blocklist: %w", err)
+	}
+	rules := &blocklistRules{domains: make(map[string]bool), modTime: info.ModTime()}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if expr, ok := strings.CutPrefix(line, "re:"); ok {
+			re, err := regexp.Compile(strings.TrimSpace(expr))
+			if err != nil {
+				return fmt.Errorf("blocklist line %d: %w", n, err)
+			}
+			rules.patterns = append(rules.patterns, re)
+			continue
+		}
+		rules.domains[strings.TrimSuffix(strings.ToLower(line), ".")] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read blocklist: %w", err)
+	}
+	b.rules.Store(rules)
+	return nil
+}
+
+// reloadIfChanged picks up edits to the file. Only the caller that claims
+// the current interval stats it; everyone else keeps the loaded rules.
+func (b *Blocklist) reloadIfChanged(now time.Time) error {
+	last := b.checkedAt.Load()
+	if now.UnixNano()-last < int64(blocklistReloadInterval) || !b.checkedAt.CompareAndSwap(last, now.UnixNano()) {
+		return nil
+	}
+	if !b.reloading.TryLock() {
+		return nil
+	}
+	defer b.reloading.Unlock()
+
+	current := b.rules.Load()
+	info, err := os.Stat(b.path)
+	if errors.Is(err, os.ErrNotExist) && current.modTime.IsZero() {
+		return nil
+	}
+	if err == nil && info.ModTime().Equal(current.modTime) {
+		return nil
+	}
+	return b.load()
+}
+
+func (b *Blocklist) Check(_ context.Context, target string) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+
+	if err := b.reloadIfChanged(time.Now()); err != nil {
+		slog.Error("failed to reload blocklist, keeping the previous rules", "error", err)
+	}
+	rules := b.rules.Load()
+
+	// Walk up the labels so "evil.example" also blocks "www.evil.example".
+	for d := host; d != ""; {
+		if rules.domains[d] {
+			return "domain " + d + " is blocklisted", nil
+		}
+		_, parent, ok := strings.Cut(d, ".")
+		if !ok {
+			break
+		}
+		d = parent
+	}
+	for _, re := range rules.patterns {
+		if re.MatchString(target) {
+			return "url matches blocklist rule " + re.String(), nil
+		}
+	}
+	return "", nil
+}
+
+// WebhookChecker asks an external service about each destination. It
+// POSTs {"url": "..."} and expects {"blocked": bool, "reason": "..."}.
+type WebhookChecker struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhookChecker(endpoint string) *WebhookChecker {
+	return &WebhookChecker{URL: endpoint, Client: &http.Client{Timeout: webhookTimeout}}
+}
+
+func (c *WebhookChecker) Check(ctx context.Context, target string) (string, error) {
+	payload, err := json.Marshal(map[string]string{"url": target})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("safety webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("safety webhook: unexpected status %s", resp.Status)
+	}
+
+	var verdict struct {
+		Blocked bool   `json:"blocked"`
+		Reason  string `json:"reason"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&verdict); err != nil {
+		return "", fmt.Errorf("safety webhook: %w", err)
+	}
+	if !verdict.Blocked {
+		return "", nil
+	}
+	if verdict.Reason == "" {
+		verdict.Reason = "blocked by safety check"
+	}
+	return verdict.Reason, nil
+}
+
+// vetNewURL checks a destination being created or changed. Unlike
+// redirects it fails closed: if the checker errors the URL is refused.
+// It returns the status to answer with when the URL is not accepted.
+func vetNewURL(ctx context.Context, checker URLChecker, target string) (int, error) {
+	if checker == nil {
+		return 0, nil
+	}
+	reason, err := checker.Check(ctx, target)
+	if err != nil {
+		slog.Error("url safety check failed", "url", target, "error", err)
+		return http.StatusServiceUnavailable, errSafetyUnavailable
+	}
+	if reason != "" {
+		return http.StatusBadRequest, fmt.Errorf("%w: %s", errURLBlocked, reason)
+	}
+	return 0, nil
+}
+
+// checkNewURL is vetNewURL for handlers: on failure it writes the error
+// response and returns false.
+func checkNewURL(w http.ResponseWriter, r *http.Request, checker URLChecker, target string) bool {
+	status, err := vetNewURL(r.Context(), checker, target)
+	if err != nil {
+		sendJSON(w, Response{Error: err.Error()}, status)
+		return false
+	}
+	return true
+}
+
+// blockedReason tells handleGet whether to refuse a redirect. checker is
+// Config.RedirectSafety, which must answer from local state. Checker
+// errors are logged and let the redirect through, so an unavailable
+// checker does not take every link down.
+func blockedReason(r *http.Request, checker URLChecker, link Link) string {
+	if checker == nil {
+		return ""
+	}
+	reason, err := checker.Check(r.Context(), link.URL)
+	if err != nil {
+		slog.Error("url safety check failed, allowing redirect", "code", link.Code, "error", err)
+		return ""
+	}
+	return reason
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeChecker blocks every URL containing "evil" and fails on "broken".
+var fakeChecker = CheckerFunc(func(_ context.Context, target string) (string, error) {
+	switch {
+	case strings.Contains(target, "broken"):
+		return "", errors.New("checker unavailable")
+	case strings.Contains(target, "evil"):
+		return "phishing", nil
+	}
+	return "", nil
+})
+
+func TestSafetyOnCreate(t *testing.T) {
+	h := NewHandler(NewMemoryStore(), Config{Safety: fakeChecker})
+
+	tests := []struct {
+		url    string
+		status int
+	}{
+		{"https://good.example", http.StatusCreated},
+		{"https://evil.example", http.StatusBadRequest},
+		{"https://broken.example", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		w := do(h, http.MethodPost, "/api/shorten", `{"url": "`+tt.url+`"}`)
+		if w.Code != tt.status {
+			t.Errorf("POST %s: status %d, want %d: %s", tt.url, w.Code, tt.status, w.Body)
+		}
+	}
+}
+
+func TestSafetyOnRedirect(t *testing.T) {
+	store := NewMemoryStore()
+	store.Save(Link{Code: "good", URL: "https://good.example/"})
+	store.Save(Link{Code: "evil", URL: "https://evil.example/"})
+	store.Save(Link{Code: "broken", URL: "https://broken.example/"})
+	store.Save(Link{Code: "off", URL: "https://good.example/", Disabled: true, DisabledReason: "ordem judicial"})
+
+	// The slow checker must never run on redirects.
+	slow := CheckerFunc(func(context.Context, string) (string, error) {
+		t.Error("Safety consulted on redirect")
+		return "", nil
+	})
+	h := NewHandler(store, Config{Safety: slow, RedirectSafety: fakeChecker})
+
+	tests := []struct {
+		code   string
+		status int
+		body   string
+	}{
+		{"good", http.StatusFound, ""},
+		{"evil", http.StatusForbidden, "destino bloqueado: phishing"},
+		{"broken", http.StatusFound, ""}, // fails open
+		{"off", http.StatusUnavailableForLegalReasons, "link desativado: ordem judicial"},
+	}
+	for _, tt := range tests {
+		w := do(h, http.MethodGet, "/"+tt.code, "")
+		if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.body) {
+			t.Errorf("GET /%s: %d %q, want %d %q", tt.code, w.Code, w.Body, tt.status, tt.body)
+		}
+	}
+}
+
+func TestBlocklistReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte("evil.example # comment\nre:/wp-login\\.php$\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b, err := OpenBlocklist(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]bool{
+		"https://evil.example/":              true,
+		"https://www.EVIL.example./x":        true,
+		"https://notevil.example/":           false,
+		"https://good.example/wp-login.php":  true,
+		"https://good.example/wp-login.php5": false,
+	}
+	for target, blocked := range tests {
+		if reason, err := b.Check(context.Background(), target); err != nil || (reason != "") != blocked {
+			t.Errorf("Check(%s) = %q, %v, want blocked %v", target, reason, err, blocked)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("good.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(path, later, later)
+	b.checkedAt.Store(0)
+	if reason, _ := b.Check(context.Background(), "https://good.example/"); reason == "" {
+		t.Error("edited blocklist not reloaded")
+	}
+	if reason, _ := b.Check(context.Background(), "https://evil.example/"); reason != "" {
+		t.Errorf("removed rule still blocks: %q", reason)
+	}
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("link not found")
+	ErrCodeExists = errors.New("code already exists")
+)
+
+// Link is a short code and the URL it redirects to.
+type Link struct {
+	Code      string     `json:"code"`
+	URL       string     `json:"url"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Owner is the API key owner that created the link; empty when the
+	// service runs without authentication.
+	Owner string `json:"owner,omitempty"`
+	// RedirectStatus is 301, 302, 307 or 308; 0 means DefaultRedirectStatus.
+	RedirectStatus int `json:"redirectStatus,omitempty"`
+	// Title is the <title> of the destination page, fetched in the
+	// background after the link is created. Shown on the preview page.
+	Title string `json:"title,omitempty"`
+	// Disabled links answer 451 instead of redirecting, with
+	// DisabledReason shown to the visitor.
+	Disabled       bool   `json:"disabled,omitempty"`
+	DisabledReason string `json:"disabledReason,omitempty"`
+	// ForwardQuery passes the query string of the short URL on to the
+	// destination; UTM parameters are always appended. See redirectTarget.
+	ForwardQuery bool `json:"forwardQuery,omitempty"`
+	UTM          *UTM `json:"utm,omitempty"`
+	// Sequential marks codes made by a SequentialGenerator, so only those
+	// count when SequentialStart restores the counter.
+	Sequential bool `json:"sequential,omitempty"`
+}
+
+// Expired reports whether the link has an expiration time at or before now.
+func (l Link) Expired(now time.Time) bool {
+	return l.ExpiresAt != nil && !now.Before(*l.ExpiresAt)
+}
+
+// Store keeps the short links. Implementations must be safe for concurrent
+// use, since chi serves each request on its own goroutine.
+type Store interface {
+	// Save stores a new link. It returns ErrCodeExists if the code is taken.
+	Save(link Link) error
+	// Get returns the link for code, or ErrNotFound.
+	Get(code string) (Link, error)
+	// Update replaces an existing link, or returns ErrNotFound.
+	Update(link Link) error
+	// Modify replaces the link for code with change(current), reading and
+	// writing under the same lock so no other write lands in between. An
+	// error from change is returned as is and nothing is written. It
+	// returns the stored link, or ErrNotFound.
+	Modify(code string, change func(Link) (Link, error)) (Link, error)
+	// Delete removes the link for code, or returns ErrNotFound.
+	Delete(code string) error
+	// DeleteIfExpired removes the link for code only if it expired at or
+	// before now, checked and deleted atomically. It reports whether the
+	// link was removed, or returns ErrNotFound.
+	DeleteIfExpired(code string, now time.Time) (bool, error)
+	// List returns every link, sorted by code.
+	List() ([]Link, error)
+	// Len returns how many links are stored, without copying them.
+	Len() (int, error)
+}
+
+// MemoryStore is an in-memory Store guarded by a RWMutex.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	links map[string]Link
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{links: make(map[string]Link)}
+}
+
+func (s *MemoryStore) Save(link Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.links[link.Code]; ok {
+		return ErrCodeExists
+	}
+	s.links[link.Code] = link
+	return nil
+}
+
+func (s *MemoryStore) Get(code string) (Link, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	link, ok := s.links[code]
+	if !ok {
+		return Link{}, ErrNotFound
+	}
+	return link, nil
+}
+
+func (s *MemoryStore) Update(link Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.links[link.Code]; !ok {
+		return ErrNotFound
+	}
+	s.links[link.Code] = link
+	return nil
+}
+
+func (s *MemoryStore) Modify(code string, change func(Link) (Link, error)) (Link, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.links[code]
+	if !ok {
+		return Link{}, ErrNotFound
+	}
+	link, err := change(current)
+	if err != nil {
+		return Link{}, err
+	}
+	link.Code = code
+	s.links[code] = link
+	return link, nil
+}
+
+func (s *MemoryStore) Delete(code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.links[code]; !ok {
+		return ErrNotFound
+	}
+	delete(s.links, code)
+	return nil
+}
+
+func (s *MemoryStore) DeleteIfExpired(code string, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	link, ok := s.links[code]
+	if !ok {
+		return false, ErrNotFound
+	}
+	if !link.Expired(now) {
+		return false, nil
+	}
+	delete(s.links, code)
+	return true, nil
+}
+
+func (s *MemoryStore) Len() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.links), nil
+}
+
+func (s *MemoryStore) List() ([]Link, error) {
+	s.mu.RLock()
+	links := make([]Link, 0, len(s.links))
+	for _, link := range s.links {
+		links = append(links, link)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(links, func(i, j int) bool { return links[i].Code < links[j].Code })
+	return links, nil
+}
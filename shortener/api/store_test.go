@@ -0,0 +1,221 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testStores opens one of each Store implementation. Run with -race.
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	fs, err := OpenFileStore(filepath.Join(t.TempDir(), "links.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fs.Close() })
+	return map[string]Store{
+		"memory": NewMemoryStore(),
+		"file":   fs,
+	}
+}
+
+func TestStoreConcurrentAccess(t *testing.T) {
+	const workers, perWorker = 8, 50
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			errs := make(chan error, workers*perWorker*4)
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < perWorker; i++ {
+						code := fmt.Sprintf("w%d-%d", w, i)
+						link := Link{Code: code, URL: "https://example.com/" + code, CreatedAt: time.Now()}
+						if err := store.Save(link); err != nil {
+							errs <- fmt.Errorf("save %s: %w", code, err)
+							continue
+						}
+						// Every worker also saves a shared code; only one may win.
+						if err := store.Save(Link{Code: "shared", URL: "https://example.com"}); err != nil && !errors.Is(err, ErrCodeExists) {
+							errs <- fmt.Errorf("save shared: %w", err)
+						}
+						if got, err := store.Get(code); err != nil || got.URL != link.URL {
+							errs <- fmt.Errorf("get %s = %+v, %v", code, got, err)
+						}
+						if _, err := store.List(); err != nil {
+							errs <- fmt.Errorf("list: %w", err)
+						}
+						if i%2 == 0 {
+							if err := store.Delete(code); err != nil {
+								errs <- fmt.Errorf("delete %s: %w", code, err)
+							}
+						}
+					}
+				}(w)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Error(err)
+			}
+
+			links, err := store.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := workers*perWorker/2 + 1; len(links) != want {
+				t.Errorf("List returned %d links, want %d", len(links), want)
+			}
+			if n, err := store.Len(); err != nil || n != len(links) {
+				t.Errorf("Len = %d, %v, want %d", n, err, len(links))
+			}
+			if !sort.SliceIsSorted(links, func(i, j int) bool { return links[i].Code < links[j].Code }) {
+				t.Error("List is not sorted by code")
+			}
+			for _, l := range links {
+				if _, err := store.Get(l.Code); err != nil {
+					t.Errorf("get %s after run: %v", l.Code, err)
+				}
+			}
+		})
+	}
+}
+
+// The file store must replay to the same state after concurrent writes.
+func TestFileStoreConcurrentReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.db")
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				code := fmt.Sprintf("w%d-%d", w, i)
+				store.Save(Link{Code: code, URL: "https://example.com"})
+				if i%3 == 0 {
+					store.Delete(code)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	before, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	after, err := reopened.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before) {
+		t.Fatalf("reopened store has %d links, want %d", len(after), len(before))
+	}
+	for i := range before {
+		if before[i].Code != after[i].Code {
+			t.Errorf("link %d: code %q after reopen, want %q", i, after[i].Code, before[i].Code)
+		}
+	}
+}
+
+func TestStoreDeleteIfExpired(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			store.Save(Link{Code: "old", URL: "https://example.com", ExpiresAt: &past})
+			store.Save(Link{Code: "new", URL: "https://example.com", ExpiresAt: &future})
+			store.Save(Link{Code: "forever", URL: "https://example.com"})
+
+			tests := []struct {
+				code    string
+				deleted bool
+				err     error
+			}{
+				{"old", true, nil},
+				{"old", false, ErrNotFound},
+				{"new", false, nil},
+				{"forever", false, nil},
+				{"missing", false, ErrNotFound},
+			}
+			for _, tt := range tests {
+				deleted, err := store.DeleteIfExpired(tt.code, now)
+				if deleted != tt.deleted || !errors.Is(err, tt.err) {
+					t.Errorf("DeleteIfExpired(%s) = %v, %v, want %v, %v", tt.code, deleted, err, tt.deleted, tt.err)
+				}
+			}
+			if _, err := store.Get("new"); err != nil {
+				t.Errorf("unexpired link removed: %v", err)
+			}
+		})
+	}
+}
+
+// Concurrent read-modify-writes must not lose each other's changes.
+func TestStoreModify(t *testing.T) {
+	stores := testStores(t)
+	stores["cached"] = NewCachedStore(NewMemoryStore(), 10)
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			store.Save(Link{Code: "abc", URL: "https://example.com"})
+
+			const workers = 20
+			var wg sync.WaitGroup
+			for range workers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := store.Modify("abc", func(link Link) (Link, error) {
+						link.Title += "x"
+						return link, nil
+					})
+					if err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+			if link, _ := store.Get("abc"); len(link.Title) != workers {
+				t.Errorf("Title = %q after %d modifications", link.Title, workers)
+			}
+
+			rejected := errors.New("rejected")
+			_, err := store.Modify("abc", func(link Link) (Link, error) {
+				link.URL = "https://changed.example"
+				return link, rejected
+			})
+			if !errors.Is(err, rejected) {
+				t.Errorf("Modify error = %v, want %v", err, rejected)
+			}
+			if link, _ := store.Get("abc"); link.URL != "https://example.com" {
+				t.Errorf("rejected change written: %q", link.URL)
+			}
+			if _, err := store.Modify("missing", func(link Link) (Link, error) { return link, nil }); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Modify(missing) = %v, want %v", err, ErrNotFound)
+			}
+		})
+	}
+}
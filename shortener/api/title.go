@@ -0,0 +1,247 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	titleFetchTimeout = 5 * time.Second
+	// maxTitleBody is how much of the destination page is read looking
+	// for <title>; it is almost always in the first few kilobytes.
+	maxTitleBody = 256 << 10
+	maxTitleLen  = 300
+	// maxTitleFetches bounds the fetches running at once. Links created
+	// while all slots are busy simply have no title.
+	maxTitleFetches = 8
+	// maxTitleRedirects is how many redirects a title fetch follows.
+	maxTitleRedirects = 5
+)
+
+var errNonPublicAddress = errors.New("destination is not a public address")
+
+// errTitleStale drops a fetched title when the link was pointed elsewhere
+// while it was being fetched.
+var errTitleStale = errors.New("link destination changed")
+
+// reservedPrefixes are the special-purpose ranges not covered by the
+// netip.Addr predicates used in publicAddr.
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),   // reserved and broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64, may map to private IPv4
+}
+
+var titleRe = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// TitleFetcher looks up the <title> of new destinations in the background,
+// so the preview page can show it without slowing down POST /api/shorten.
+type TitleFetcher struct {
+	client *http.Client
+	slots  chan struct{}
+
+	mu      sync.Mutex
+	closed  bool
+	running sync.WaitGroup
+}
+
+// NewTitleFetcher returns a fetcher whose client only connects to public
+// addresses. Anyone who can shorten a link picks the URL fetched, so
+// without this the service could be made to reach loopback, the private
+// network or cloud metadata endpoints like 169.254.169.254.
+func NewTitleFetcher() *TitleFetcher {
+	dialer := &net.Dialer{
+		Timeout: titleFetchTimeout,
+		// Control sees the resolved address, so a public name pointing to
+		// a private address is refused too.
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !publicAddr(addrPort.Addr()) {
+				return errNonPublicAddress
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would make the dialer check the proxy instead of the target.
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &TitleFetcher{
+		client: &http.Client{
+			Timeout:       titleFetchTimeout,
+			Transport:     transport,
+			CheckRedirect: checkTitleRedirect,
+		},
+		slots: make(chan struct{}, maxTitleFetches),
+	}
+}
+
+// checkTitleRedirect applies the dialer's rule to each redirect before it
+// is followed: only http(s) to names that resolve to public addresses.
+func checkTitleRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxTitleRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxTitleRedirects)
+	}
+	return checkPublicURL(req.Context(), req.URL)
+}
+
+func checkPublicURL(ctx context.Context, u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	host := u.Hostname()
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !publicAddr(addr) {
+			return errNonPublicAddress
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !publicAddr(addr) {
+			return errNonPublicAddress
+		}
+	}
+	return nil
+}
+
+// publicAddr reports whether addr is a globally routable unicast address.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, p := range reservedPrefixes {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchAsync fetches the title of link.URL and stores it on the link,
+// unless the link was changed or removed in the meantime. A nil or closed
+// fetcher does nothing.
+func (f *TitleFetcher) fetchAsync(store Store, link Link) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return
+	}
+	select {
+	case f.slots <- struct{}{}:
+	default:
+		slog.Warn("too many title fetches running, skipping", "code", link.Code)
+		return
+	}
+
+	f.running.Add(1)
+	go func() {
+		defer f.running.Done()
+		defer func() { <-f.slots }()
+
+		title, err := f.fetch(link.URL)
+		if err != nil {
+			slog.Info("could not fetch page title", "code", link.Code, "url", link.URL, "error", err)
+			return
+		}
+		if title == "" {
+			return
+		}
+
+		_, err = store.Modify(link.Code, func(current Link) (Link, error) {
+			if current.URL != link.URL {
+				return current, errTitleStale
+			}
+			current.Title = title
+			return current, nil
+		})
+		if err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, errTitleStale) {
+			slog.Error("failed to save page title", "code", link.Code, "error", err)
+		}
+	}()
+}
+
+// Close stops starting new fetches and waits for the running ones, which
+// write to the store, to finish. Call it before closing the store.
+func (f *TitleFetcher) Close() {
+	f.mu.Lock()
+	f.closed = true
+	f.mu.Unlock()
+	f.running.Wait()
+}
+
+func (f *TitleFetcher) fetch(target string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), titleFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "shortener-preview/1.0")
+	req.Header.Set("Accept", "text/html")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/html" {
+		return "", nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxTitleBody))
+	if err != nil {
+		return "", err
+	}
+	return parseTitle(body), nil
+}
+
+// parseTitle returns the unescaped, whitespace-collapsed text of the first
+// <title> element, cut at maxTitleLen characters.
+func parseTitle(page []byte) string {
+	m := titleRe.FindSubmatch(page)
+	if m == nil {
+		return ""
+	}
+	raw := bytes.ToValidUTF8(m[1], []byte("�"))
+	title := strings.Join(strings.Fields(html.UnescapeString(string(raw))), " ")
+	if utf8.RuneCountInString(title) > maxTitleLen {
+		title = string([]rune(title)[:maxTitleLen]) + "…"
+	}
+	return title
+}
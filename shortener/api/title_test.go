@@ -0,0 +1,59 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fc00::1", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+		{"::ffff:127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := publicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("publicAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestTitleFetcherRefusesLoopback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<title>internal</title>"))
+	}))
+	defer srv.Close()
+
+	if _, err := NewTitleFetcher().fetch(srv.URL); !errors.Is(err, errNonPublicAddress) {
+		t.Errorf("fetch(%s) error = %v, want %v", srv.URL, err, errNonPublicAddress)
+	}
+}
+
+func TestCheckTitleRedirectRefusesPrivate(t *testing.T) {
+	for _, target := range []string{"http://169.254.169.254/latest/meta-data/", "http://localhost/", "file:///etc/passwd"} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if err := checkTitleRedirect(req, nil); err == nil {
+			t.Errorf("redirect to %s allowed", target)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxUTMLength bounds each stored UTM value.
+const maxUTMLength = 200
+
+var errUTMLength = fmt.Errorf("utm values must have at most %d characters", maxUTMLength)
+
+// UTM holds the campaign parameters appended to the destination on every
+// redirect. Empty fields are not added.
+type UTM struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+// params pairs each query parameter name with its value.
+func (u UTM) params() [][2]string {
+	return [][2]string{
+		{"utm_source", u.Source},
+		{"utm_medium", u.Medium},
+		{"utm_campaign", u.Campaign},
+		{"utm_term", u.Term},
+		{"utm_content", u.Content},
+	}
+}
+
+// normalizeUTM trims the values and returns nil when none is set, so links
+// without campaign parameters store nothing.
+func normalizeUTM(u *UTM) (*UTM, error) {
+	if u == nil {
+		return nil, nil
+	}
+	n := UTM{
+		Source:   strings.TrimSpace(u.Source),
+		Medium:   strings.TrimSpace(u.Medium),
+		Campaign: strings.TrimSpace(u.Campaign),
+		Term:     strings.TrimSpace(u.Term),
+		Content:  strings.TrimSpace(u.Content),
+	}
+	if n == (UTM{}) {
+		return nil, nil
+	}
+	for _, p := range n.params() {
+		if len(p[1]) > maxUTMLength {
+			return nil, errUTMLength
+		}
+	}
+	return &n, nil
+}
+
+// redirectTarget is the URL handleGet redirects to. Query parameters are
+// merged in this order of precedence: the ones already in the destination,
+// then the stored UTM values (which replace a destination utm_* of the same
+// name), then, when ForwardQuery is set, the ones of the incoming request
+// for names not taken yet. Visitors can add parameters but never change the
+// destination's or the campaign's. The destination's query is kept byte
+// for byte, minus the utm_* pairs being replaced, and the new pairs are
+// appended after it. The destination is returned untouched when there is
+// nothing to merge.
+func redirectTarget(link Link, r *http.Request) string {
+	forward := link.ForwardQuery && r.URL.RawQuery != ""
+	if link.UTM == nil && !forward {
+		return link.URL
+	}
+
+	u, err := url.Parse(link.URL)
+	if err != nil {
+		return link.URL
+	}
+	taken := u.Query()
+	added := url.Values{}
+	if link.UTM != nil {
+		for _, p := range link.UTM.params() {
+			if p[1] != "" {
+				added.Set(p[0], p[1])
+			}
+		}
+	}
+	if forward {
+		for name, values := range r.URL.Query() {
+			_, inDestination := taken[name]
+			_, inUTM := added[name]
+			if !inDestination && !inUTM {
+				added[name] = values
+			}
+		}
+	}
+	if len(added) == 0 {
+		return link.URL
+	}
+
+	raw := withoutParams(u.RawQuery, added)
+	if raw != "" {
+		raw += "&"
+	}
+	u.RawQuery = raw + added.Encode()
+	return u.String()
+}
+
+// withoutParams drops from rawQuery the pairs whose decoded name is in
+// names, leaving every other pair exactly as written.
+func withoutParams(rawQuery string, names url.Values) string {
+	if rawQuery == "" {
+		return ""
+	}
+	pairs := strings.Split(rawQuery, "&")
+	kept := pairs[:0]
+	for _, pair := range pairs {
+		name, _, _ := strings.Cut(pair, "=")
+		if decoded, err := url.QueryUnescape(name); err == nil {
+			name = decoded
+		}
+		if _, drop := names[name]; !drop {
+			kept = append(kept, pair)
+		}
+	}
+	return strings.Join(kept, "&")
+}
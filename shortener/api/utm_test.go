@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectTarget(t *testing.T) {
+	campaign := &UTM{Source: "newsletter", Campaign: "outubro"}
+	tests := []struct {
+		name    string
+		link    Link
+		request string
+		want    string
+	}{
+		{
+			name:    "nothing to merge",
+			link:    Link{URL: "https://example.com/p?b&a=1"},
+			request: "/x?ref=abc",
+			want:    "https://example.com/p?b&a=1",
+		},
+		{
+			name:    "destination query kept verbatim",
+			link:    Link{URL: "https://example.com/p?b&z=1&a=%7E#top", UTM: campaign},
+			request: "/x",
+			want:    "https://example.com/p?b&z=1&a=%7E&utm_campaign=outubro&utm_source=newsletter#top",
+		},
+		{
+			name:    "utm replaces destination utm",
+			link:    Link{URL: "https://example.com/p?utm_source=old&id=1&utm%5Fcampaign=x", UTM: campaign},
+			request: "/x",
+			want:    "https://example.com/p?id=1&utm_campaign=outubro&utm_source=newsletter",
+		},
+		{
+			name:    "forwarded only for free names",
+			link:    Link{URL: "https://example.com/p?id=42", ForwardQuery: true, UTM: campaign},
+			request: "/x?ref=a+b&id=7&utm_source=evil",
+			want:    "https://example.com/p?id=42&ref=a+b&utm_campaign=outubro&utm_source=newsletter",
+		},
+		{
+			name:    "all forwarded names taken",
+			link:    Link{URL: "https://example.com/p?id=42", ForwardQuery: true},
+			request: "/x?id=7",
+			want:    "https://example.com/p?id=42",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redirectTarget(tt.link, httptest.NewRequest("GET", tt.request, nil)); got != tt.want {
+				t.Errorf("redirectTarget = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxURLLength keeps stored destinations within what browsers accept.
+const maxURLLength = 2048
+
+var (
+	errURLEmpty       = errors.New("url is required")
+	errURLTooLong     = errors.New("url is too long")
+	errURLInvalid     = errors.New("invalid url passed")
+	errURLNotAbsolute = errors.New("url must be absolute, like https://example.com")
+	errURLScheme      = errors.New("url scheme must be http or https")
+	errURLNoHost      = errors.New("url must have a host")
+	errURLCredentials = errors.New("url must not contain credentials")
+	errURLSelf        = errors.New("url must not point back to this shortener")
+)
+
+// normalizeURL validates a destination URL and returns its canonical form:
+// lower-case scheme and host, default ports dropped and an empty path
+// replaced by "/". selfHosts are the hosts this service answers on (see
+// serviceHosts); links pointing back to any of them are rejected to avoid
+// redirect loops.
+func normalizeURL(raw string, selfHosts ...string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", errURLEmpty
+	}
+	if len(raw) > maxURLLength {
+		return "", errURLTooLong
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", errURLInvalid
+	}
+	if !u.IsAbs() {
+		return "", errURLNotAbsolute
+	}
+
+	// javascript:, data:, file: and friends all end up here.
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", errURLScheme
+	}
+	if u.Opaque != "" || u.Hostname() == "" {
+		return "", errURLNoHost
+	}
+	if u.User != nil {
+		return "", errURLCredentials
+	}
+
+	u.Host = normalizeHost(u.Scheme, u.Host)
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	for _, self := range selfHosts {
+		if self != "" && u.Host == normalizeHost(u.Scheme, self) {
+			return "", errURLSelf
+		}
+	}
+	return u.String(), nil
+}
+
+// serviceHosts are the hosts a request may have reached the service on:
+// the Host header and, when configured, the host of the public base URL,
+// which differs from it behind a proxy.
+func serviceHosts(r *http.Request, baseURL string) []string {
+	hosts := []string{r.Host}
+	if u, err := url.Parse(baseURL); err == nil && u.Host != "" {
+		hosts = append(hosts, u.Host)
+	}
+	return hosts
+}
+
+// normalizeHost lower-cases host and removes the port when it is the
+// default one for scheme.
+func normalizeHost(scheme, host string) string {
+	host = strings.ToLower(host)
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return host
+	}
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		if strings.Contains(hostname, ":") {
+			return "[" + hostname + "]"
+		}
+		return hostname
+	}
+	return host
+}
+
+const (
+	minAliasLength = 3
+	maxAliasLength = 64
+)
+
+// reservedAliases are path segments used by the service itself.
+var reservedAliases = map[string]bool{
+	"api":     true,
+	"healthz": true,
+	"readyz":  true,
+	"metrics": true,
+	"debug":   true,
+	"static":  true,
+}
+
+var (
+	errAliasLength   = fmt.Errorf("alias must have between %d and %d characters", minAliasLength, maxAliasLength)
+	errAliasChars    = errors.New("alias may only contain letters, digits, '-' and '_'")
+	errAliasReserved = errors.New("alias is reserved")
+	errAliasTaken    = errors.New("alias already in use")
+)
+
+// validateAlias checks a vanity code requested in PostBody.Alias.
+func validateAlias(alias string) error {
+	if len(alias) < minAliasLength || len(alias) > maxAliasLength {
+		return errAliasLength
+	}
+	for i := 0; i < len(alias); i++ {
+		if !isCodeChar(alias[i]) {
+			return errAliasChars
+		}
+	}
+	if reservedAliases[strings.ToLower(alias)] {
+		return errAliasReserved
+	}
+	return nil
+}
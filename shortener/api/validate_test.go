@@ -0,0 +1,90 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeURLRejectsServiceHosts(t *testing.T) {
+	// Behind a proxy the request arrives on an internal host, while links
+	// use the public base URL.
+	r := httptest.NewRequest("POST", "http://10.0.0.5:8080/api/shorten", nil)
+	hosts := serviceHosts(r, "https://sho.rt")
+
+	tests := []struct {
+		url string
+		err error
+	}{
+		{"https://sho.rt/abc", errURLSelf},
+		{"HTTPS://SHO.RT:443/abc", errURLSelf},
+		{"http://sho.rt/abc", errURLSelf},
+		{"http://10.0.0.5:8080/abc", errURLSelf},
+		{"https://sho.rt.example/abc", nil},
+		{"https://example.com", nil},
+	}
+	for _, tt := range tests {
+		if _, err := normalizeURL(tt.url, hosts...); !errors.Is(err, tt.err) {
+			t.Errorf("normalizeURL(%q) error = %v, want %v", tt.url, err, tt.err)
+		}
+	}
+}
+
+func TestValidateAlias(t *testing.T) {
+	tests := []struct {
+		alias string
+		err   error
+	}{
+		{"promo2026", nil},
+		{"my-alias_2", nil},
+		{"abc", nil},
+		{strings.Repeat("a", maxAliasLength), nil},
+		{"ab", errAliasLength},
+		{strings.Repeat("a", maxAliasLength+1), errAliasLength},
+		{"with space", errAliasChars},
+		{"promo/2026", errAliasChars},
+		{"ação", errAliasChars},
+		{"api", errAliasReserved},
+		{"Metrics", errAliasReserved},
+		{"readyz", errAliasReserved},
+	}
+	for _, tt := range tests {
+		if err := validateAlias(tt.alias); !errors.Is(err, tt.err) {
+			t.Errorf("validateAlias(%q) = %v, want %v", tt.alias, err, tt.err)
+		}
+	}
+}
+
+func TestAliasConflicts(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	store := NewMemoryStore()
+	store.Save(Link{Code: "taken", URL: "https://old.example/"})
+	store.Save(Link{Code: "expired", URL: "https://old.example/", ExpiresAt: &past})
+	h := NewHandler(store, Config{})
+
+	tests := []struct {
+		alias  string
+		status int
+	}{
+		{"taken", http.StatusConflict},
+		{"expired", http.StatusCreated},
+		{"fresh", http.StatusCreated},
+		{"fresh", http.StatusConflict},
+		{"api", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := do(h, http.MethodPost, "/api/shorten", `{"url": "https://new.example/", "alias": "`+tt.alias+`"}`)
+		if w.Code != tt.status {
+			t.Errorf("alias %q: status %d, want %d: %s", tt.alias, w.Code, tt.status, w.Body)
+		}
+	}
+	if link, _ := store.Get("expired"); link.URL != "https://new.example/" || link.ExpiresAt != nil {
+		t.Errorf("expired alias not reused: %+v", link)
+	}
+	if link, _ := store.Get("taken"); link.URL != "https://old.example/" {
+		t.Errorf("taken alias overwritten: %+v", link)
+	}
+}
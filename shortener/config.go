@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix namespaces the environment variables: -store-path is read
+// from SHORTENER_STORE_PATH.
+const envPrefix = "SHORTENER_"
+
+// -config is read back by loadConfig through its FlagSet.
+var _ = flag.String("config", "", "optional YAML or JSON file with settings keyed by flag name (env "+envPrefix+"CONFIG)")
+
+// loadConfig fills the flags of fs not given on the command line, first
+// from the environment and then from the file named by its -config flag,
+// so the precedence is flag > env > file > default. It must run after
+// fs.Parse.
+func loadConfig(fs *flag.FlagSet) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	config := fs.Lookup("config")
+	if !explicit["config"] {
+		if path, ok := os.LookupEnv(envName("config")); ok {
+			config.Value.Set(path)
+		}
+	}
+	path := config.Value.String()
+	file, err := readConfigFile(fs, path)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] || f.Name == "config" {
+			return
+		}
+		value, ok := os.LookupEnv(envName(f.Name))
+		source := envName(f.Name)
+		if !ok {
+			value, ok = file[f.Name]
+			source = path
+		}
+		if !ok {
+			return
+		}
+		if err := f.Value.Set(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid value %q for %s: %w", source, value, f.Name, err))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// readConfigFile returns the settings in path as values for the flags of
+// fs. The file is a flat map of flag names; ".json" files are read as JSON
+// and anything else as YAML. An empty path means no file.
+func readConfigFile(fs *flag.FlagSet, path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	var raw map[string]any
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber() // keep 1000000 from becoming "1e+06"
+		err = dec.Decode(&raw)
+	} else {
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+
+	settings := make(map[string]string, len(raw))
+	var unknown []string
+	for name, value := range raw {
+		if fs.Lookup(name) == nil || name == "config" {
+			unknown = append(unknown, name)
+			continue
+		}
+		switch value.(type) {
+		case map[string]any, []any:
+			return nil, fmt.Errorf("config %s: %s must be a single value", path, name)
+		}
+		settings[name] = fmt.Sprint(value)
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("config %s: unknown settings %s", path, strings.Join(unknown, ", "))
+	}
+	return settings, nil
+}
+
+// parseBaseURL checks the public base URL used to build short URLs and
+// drops a trailing slash. An empty value means "use the request host".
+func parseBaseURL(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("base-url must be an absolute http or https URL, got %q", raw)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("base-url must not have a query or fragment, got %q", raw)
+	}
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testFlags struct {
+	fs          *flag.FlagSet
+	addr, store string
+	rate        float64
+	burst       int
+}
+
+// newTestFlags registers a few settings like the ones in main.go.
+func newTestFlags() *testFlags {
+	f := &testFlags{fs: flag.NewFlagSet("test", flag.ContinueOnError)}
+	f.fs.StringVar(&f.addr, "addr", ":8080", "")
+	f.fs.StringVar(&f.store, "store", "memory", "")
+	f.fs.Float64Var(&f.rate, "shorten-rate", 1, "")
+	f.fs.IntVar(&f.burst, "bulk-burst", 1000, "")
+	f.fs.String("config", "", "")
+	return f
+}
+
+func writeConfig(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfig(t, "config.yaml", "addr: \":7000\"\nstore: file\nshorten-rate: 0.5\n")
+	t.Setenv("SHORTENER_STORE", "memory")
+	t.Setenv("SHORTENER_SHORTEN_RATE", "2")
+	t.Setenv("SHORTENER_CONFIG", path)
+
+	f := newTestFlags()
+	if err := f.fs.Parse([]string{"-shorten-rate", "3"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(f.fs); err != nil {
+		t.Fatal(err)
+	}
+
+	if f.rate != 3 {
+		t.Errorf("shorten-rate = %v, want the flag value 3", f.rate)
+	}
+	if f.store != "memory" {
+		t.Errorf("store = %q, want the env value memory", f.store)
+	}
+	if f.addr != ":7000" {
+		t.Errorf("addr = %q, want the file value :7000", f.addr)
+	}
+	if f.burst != 1000 {
+		t.Errorf("bulk-burst = %d, want the default 1000", f.burst)
+	}
+}
+
+func TestLoadConfigFlagPathWinsOverEnv(t *testing.T) {
+	t.Setenv("SHORTENER_CONFIG", filepath.Join(t.TempDir(), "missing.yaml"))
+	path := writeConfig(t, "config.yaml", "addr: \":7000\"\n")
+
+	f := newTestFlags()
+	f.fs.Parse([]string{"-config", path})
+	if err := loadConfig(f.fs); err != nil {
+		t.Fatal(err)
+	}
+	if f.addr != ":7000" {
+		t.Errorf("addr = %q, want :7000 from the -config file", f.addr)
+	}
+}
+
+func TestReadConfigFile(t *testing.T) {
+	f := newTestFlags()
+
+	// Without UseNumber, 1000000 would come back as "1e+06".
+	path := writeConfig(t, "config.json", `{"bulk-burst": 1000000, "shorten-rate": 0.25, "store": "file"}`)
+	settings, err := readConfigFile(f.fs, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"bulk-burst": "1000000", "shorten-rate": "0.25", "store": "file"}
+	for name, value := range want {
+		if settings[name] != value {
+			t.Errorf("%s = %q, want %q", name, settings[name], value)
+		}
+	}
+
+	tests := []struct {
+		name, data, err string
+	}{
+		{"unknown.yaml", "addr: \":1\"\nstorage: file\ncache: 10\n", "unknown settings cache, storage"},
+		{"config.yaml", "config: other.yaml\n", "unknown settings config"},
+		{"nested.yaml", "store:\n  backend: file\n", "must be a single value"},
+		{"broken.json", `{"addr": `, "parse config"},
+	}
+	for _, tt := range tests {
+		_, err := readConfigFile(f.fs, writeConfig(t, tt.name, tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestLoadConfigInvalidValue(t *testing.T) {
+	t.Setenv("SHORTENER_BULK_BURST", "lots")
+	f := newTestFlags()
+	f.fs.Parse(nil)
+	err := loadConfig(f.fs)
+	if err == nil || !strings.Contains(err.Error(), "SHORTENER_BULK_BURST") {
+		t.Errorf("loadConfig = %v, want an error naming SHORTENER_BULK_BURST", err)
+	}
+}
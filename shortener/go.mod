@@ -5,4 +5,6 @@ go 1.23.0
 require (
 	github.com/go-chi/chi v1.5.5
 	github.com/go-chi/chi/v5 v5.2.3
+	gopkg.in/yaml.v3 v3.0.1
+	rsc.io/qr v0.2.0
 )
@@ -3,20 +3,88 @@
 // Features:
 // - Shorten URLs
 // - Redirect to original URL
-// - In-memory storage
+// - In-memory or append-only file storage
 // - Basic error handling
 
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"shortener/api"
+	"syscall"
 	"time"
 )
 
+var (
+	addr         = flag.String("addr", ":8080", "address the HTTP server listens on")
+	baseURL      = flag.String("base-url", "", "public URL of the service used in short URLs, like https://sho.rt (default: the request host)")
+	readTimeout  = flag.Duration("read-timeout", 10*time.Second, "maximum duration for reading a request")
+	writeTimeout = flag.Duration("write-timeout", 10*time.Second, "maximum duration for writing a response")
+	idleTimeout  = flag.Duration("idle-timeout", 120*time.Second, "how long keep-alive connections wait for the next request")
+
+	shutdownTimeout = flag.Duration("shutdown-timeout", 15*time.Second, "how long in-flight requests get to finish on SIGINT/SIGTERM")
+	shutdownDelay   = flag.Duration("shutdown-delay", 0, "how long /readyz answers 503 on SIGINT/SIGTERM before the server stops accepting connections")
+
+	storeBackend = flag.String("store", "memory", "storage backend: memory or file")
+	storePath    = flag.String("store-path", "shortener.db", "path of the append-only log used by the file backend")
+	cacheSize    = flag.Int("cache-size", 0, "links kept in an LRU cache in front of a backend that reads from disk on lookups (0 disables; memory and file never need it)")
+	codeStrategy = flag.String("code-strategy", "random", "short code strategy: random, sequential or hash")
+	codeLength   = flag.Int("code-length", api.DefaultCodeLength, "length of generated codes (minimum length for sequential)")
+	codeAlphabet = flag.String("code-alphabet", api.DefaultAlphabet, "characters used in generated codes")
+
+	janitorInterval = flag.Duration("janitor-interval", time.Minute, "how often expired links are purged")
+
+	keysPath = flag.String("keys-path", "", "API keys file; when set, the /api routes require a key")
+
+	shortenRate   = flag.Float64("shorten-rate", 1, "POST /api/shorten requests per second per client (0 disables)")
+	shortenBurst  = flag.Int("shorten-burst", 10, "POST /api/shorten burst size per client")
+	redirectRate  = flag.Float64("redirect-rate", 20, "GET /{code} requests per second per client (0 disables)")
+	redirectBurst = flag.Int("redirect-burst", 50, "GET /{code} burst size per client")
+	bulkRate      = flag.Float64("bulk-rate", 1, "links per second per client created through POST /api/shorten/bulk (0 disables)")
+	bulkBurst     = flag.Int("bulk-burst", 1000, "links per client in a burst of POST /api/shorten/bulk, also the largest batch accepted")
+	importRate    = flag.Float64("import-rate", 0.1, "POST /api/import requests per second per client (0 disables)")
+	importBurst   = flag.Int("import-burst", 2, "POST /api/import burst size per client")
+
+	trustedProxies = flag.String("trusted-proxies", "", "comma-separated addresses or CIDRs of reverse proxies whose X-Forwarded-For identifies the client")
+
+	blocklistPath = flag.String("blocklist", "", "file of blocked domains and re: patterns, reloaded on change")
+	safetyWebhook = flag.String("safety-webhook", "", "URL of an external checker consulted when links are created, changed or imported")
+
+	fetchTitles = flag.Bool("fetch-titles", false, "fetch the page title of new links for the preview page (GET /{code}+); only public addresses are contacted")
+)
+
 func main() {
+	flag.Parse()
+	if err := loadConfig(flag.CommandLine); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if flag.Arg(0) == "keys" {
+		if err := runKeys(*keysPath, flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if flag.Arg(0) == "links" {
+		checker, _, err := safetyCheckers(*blocklistPath, *safetyWebhook)
+		if err == nil {
+			err = runLinks(*storeBackend, *storePath, *baseURL, checker, flag.Args()[1:])
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if err := run(); err != nil {
 		slog.Error("Error running the service", "error", err)
 		os.Exit(1)
@@ -25,21 +93,172 @@ func main() {
 
 }
 
-func run() error {
-	db := make(map[string]string) // In-memory storage
-	handler := api.NewHandler(db)
+func run() (err error) {
+	base, err := parseBaseURL(*baseURL)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStore(*storeBackend, *storePath)
+	if err != nil {
+		return err
+	}
+	if closer, ok := store.(io.Closer); ok {
+		// Runs last, after the server and title fetches have stopped, so
+		// no write can arrive once the file is synced and closed.
+		defer func() {
+			if cerr := closer.Close(); cerr != nil && err == nil {
+				err = fmt.Errorf("close store: %w", cerr)
+			}
+		}()
+	}
+	store = withCache(store, *storeBackend, *cacheSize)
+
+	links, err := store.List()
+	if err != nil {
+		return err
+	}
+	gen, err := api.NewCodeGenerator(*codeStrategy, *codeLength, *codeAlphabet, api.SequentialStart(links, *codeAlphabet))
+	if err != nil {
+		return err
+	}
+	analytics := api.NewAnalytics(api.DefaultAnalyticsBuffer)
+	// Stops the aggregating goroutine. Stats live only in memory and do
+	// not survive a restart.
+	defer analytics.Close()
+
+	cfg := api.Config{
+		Readiness:     &api.Readiness{},
+		CodeGenerator: gen,
+		Analytics:     analytics,
+		ShortenLimit:  api.RateLimit{Rate: *shortenRate, Burst: *shortenBurst},
+		RedirectLimit: api.RateLimit{Rate: *redirectRate, Burst: *redirectBurst},
+		BulkLimit:     api.RateLimit{Rate: *bulkRate, Burst: *bulkBurst},
+		ImportLimit:   api.RateLimit{Rate: *importRate, Burst: *importBurst},
+		BaseURL:       base,
+	}
+	if *fetchTitles {
+		cfg.Titles = api.NewTitleFetcher()
+		// Runs before the analytics and store are closed: fetches still
+		// running save titles to the store.
+		defer cfg.Titles.Close()
+	}
+	if *keysPath != "" {
+		keys, err := api.OpenKeyStore(*keysPath)
+		if err != nil {
+			return err
+		}
+		cfg.Keys = keys
+		slog.Info("API key authentication enabled", "keys", *keysPath)
+	}
+	if cfg.TrustedProxies, err = api.ParseTrustedProxies(*trustedProxies); err != nil {
+		return err
+	}
+	cfg.Safety, cfg.RedirectSafety, err = safetyCheckers(*blocklistPath, *safetyWebhook)
+	if err != nil {
+		return err
+	}
+	handler := api.NewHandler(store, cfg)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	janitorDone := make(chan struct{})
+	go func() {
+		defer close(janitorDone)
+		api.RunJanitor(ctx, store, analytics, *janitorInterval)
+	}()
+	defer func() {
+		stop()
+		<-janitorDone
+	}()
 
 	s := http.Server{
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  120 * time.Second,
-		Addr:         ":8080",
+		ReadTimeout:  *readTimeout,
+		WriteTimeout: *writeTimeout,
+		IdleTimeout:  *idleTimeout,
+		Addr:         *addr,
 		Handler:      handler,
 	}
 
-	slog.Info("Starting server on :8080")
-	if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Starting server", "addr", *addr)
+		serveErr <- s.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
 		return err
+	case <-ctx.Done():
+	}
+	// Restore the default behaviour so a second Ctrl+C kills the process
+	// if draining hangs.
+	stop()
+
+	// Fail readiness first, so a load balancer stops sending traffic
+	// while the listener is still open.
+	cfg.Readiness.Drain()
+	if *shutdownDelay > 0 {
+		slog.Info("Failing readiness before shutdown", "delay", *shutdownDelay)
+		time.Sleep(*shutdownDelay)
+	}
+
+	slog.Info("Shutting down, draining connections", "timeout", *shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
 	}
 	return nil
 }
+
+// withCache puts a CachedStore of size links in front of store when the
+// backend reads from disk on Get. Both built-in backends keep every link
+// in memory, so for them the cache would only add a lock and list moves
+// to each redirect and the flag is ignored.
+func withCache(store api.Store, backend string, size int) api.Store {
+	if size <= 0 {
+		return store
+	}
+	switch backend {
+	case "memory", "file":
+		slog.Warn("ignoring -cache-size: the backend already serves lookups from memory", "store", backend)
+		return store
+	}
+	return api.NewCachedStore(store, size)
+}
+
+// safetyCheckers builds the URL checks for new destinations (blocklist
+// then webhook) and for redirects (blocklist only, since the webhook would
+// add a remote call to every visit). Unset checks are nil.
+func safetyCheckers(blocklistPath, webhook string) (create, redirect api.URLChecker, err error) {
+	var checkers api.MultiChecker
+	if blocklistPath != "" {
+		blocklist, err := api.OpenBlocklist(blocklistPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		slog.Info("URL blocklist enabled", "path", blocklistPath)
+		checkers = append(checkers, blocklist)
+		redirect = blocklist
+	}
+	if webhook != "" {
+		slog.Info("URL safety webhook enabled", "url", webhook)
+		checkers = append(checkers, api.NewWebhookChecker(webhook))
+	}
+	if len(checkers) == 0 {
+		return nil, nil, nil
+	}
+	return checkers, redirect, nil
+}
+
+func openStore(backend, path string) (api.Store, error) {
+	switch backend {
+	case "memory":
+		return api.NewMemoryStore(), nil
+	case "file":
+		slog.Info("Opening file store", "path", path)
+		return api.OpenFileStore(path)
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", backend)
+	}
+}